@@ -0,0 +1,113 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// minHMACSecretLength est la taille minimale d'un secret HS256 (RFC 7518, section 3.2).
+const minHMACSecretLength = 32
+
+// signingMethod retourne l'algorithme imposé par le type de la clé, privée ou publique.
+// Chaque clé n'accepte qu'un seul algorithme, ce qui rend impossible la confusion d'algorithmes.
+func signingMethod(key interface{}) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		return ecdsaSigningMethod(k.Curve)
+	case *ecdsa.PublicKey:
+		return ecdsaSigningMethod(k.Curve)
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	case []byte:
+		if len(k) < minHMACSecretLength {
+			return nil, fmt.Errorf("HMAC secret must be at least %d bytes", minHMACSecretLength)
+		}
+		return jwt.SigningMethodHS256, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func ecdsaSigningMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, fmt.Errorf("unsupported elliptic curve %s", curve.Params().Name)
+	}
+}
+
+// publicKeyOf retourne la clé de vérification correspondant à une clé de signature.
+// Pour HMAC, le secret sert aux deux usages.
+func publicKeyOf(privateKey crypto.PrivateKey) (crypto.PublicKey, error) {
+	switch k := privateKey.(type) {
+	case []byte:
+		return k, nil
+	case interface{ Public() crypto.PublicKey }:
+		return k.Public(), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", privateKey)
+	}
+}
+
+// parsePrivateKeyPEM décode une clé privée RSA, ECDSA ou Ed25519 au format PEM.
+func parsePrivateKeyPEM(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("key must be PEM encoded")
+	}
+	return parsePrivateKeyDER(block.Bytes)
+}
+
+// parsePrivateKeyDER décode une clé privée PKCS#8, PKCS#1 ou SEC 1.
+func parsePrivateKeyDER(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key format")
+}
+
+// parsePublicKeyPEM décode une clé publique RSA, ECDSA ou Ed25519 au format PEM,
+// éventuellement contenue dans un certificat.
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("key must be PEM encoded")
+	}
+	return parsePublicKeyDER(block.Bytes)
+}
+
+// parsePublicKeyDER décode une clé publique PKIX ou PKCS#1, ou un certificat X.509.
+func parsePublicKeyDER(der []byte) (crypto.PublicKey, error) {
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(der); err == nil {
+		return cert.PublicKey, nil
+	}
+	return nil, errors.New("unsupported public key format")
+}
@@ -0,0 +1,127 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigningMethodsFromPEM(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		privateKey crypto.Signer
+		alg        string
+	}{
+		{"ES256", p256, "ES256"},
+		{"ES384", p384, "ES384"},
+		{"EdDSA", edKey, "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			setPEMEnv(t, "TEST_PRIVATE_KEY", tt.privateKey, true)
+			setPEMEnv(t, "TEST_PUBLIC_KEY", tt.privateKey.Public(), false)
+			j := New(time.Hour)
+			j.OnError(func(error) {})
+			assert.NoError(t, j.LoadPrivateKeyFromEnv("TEST_PRIVATE_KEY"))
+			assert.NoError(t, j.LoadPublicKeyFromEnv("TEST_PUBLIC_KEY"))
+
+			// Test
+			token, err := j.GenerateToken("testData")
+			assert.NoError(t, err)
+			claims, err := j.ValidateToken(token)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, "testData", claims["data"])
+			parsed, _, err := jwtlib.NewParser().ParseUnverified(token, jwtlib.MapClaims{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.alg, parsed.Method.Alg())
+		})
+	}
+}
+
+func TestLoadHMACSecretFromEnv(t *testing.T) {
+	// Setup
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	assert.NoError(t, err)
+	os.Setenv("TEST_HMAC_SECRET", base64.StdEncoding.EncodeToString(secret))
+	defer os.Unsetenv("TEST_HMAC_SECRET")
+	os.Setenv("TEST_SHORT_SECRET", base64.StdEncoding.EncodeToString([]byte("short")))
+	defer os.Unsetenv("TEST_SHORT_SECRET")
+
+	j := New(time.Hour)
+	j.OnError(func(error) {})
+
+	// Test
+	assert.Error(t, j.LoadHMACSecretFromEnv("TEST_SHORT_SECRET"))
+	assert.NoError(t, j.LoadHMACSecretFromEnv("TEST_HMAC_SECRET"))
+	token, err := j.GenerateToken("testData")
+	assert.NoError(t, err)
+
+	// Assert
+	_, err = j.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Empty(t, j.JWKS().Keys, "HMAC secrets must never be published")
+}
+
+func TestAlgorithmConfusionIsRejected(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshalPKIX(t, j.publicKey)})
+
+	// Test: an HS256 token keyed with the RSA public key, the classic confusion attack.
+	forged, err := jwtlib.NewWithClaims(jwtlib.SigningMethodHS256, jwtlib.MapClaims{"data": "forged"}).SignedString(publicPEM)
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(forged)
+
+	// Assert
+	assert.Error(t, err)
+
+	// A token signed with the right key but announcing another algorithm is rejected too.
+	other, err := jwtlib.NewWithClaims(jwtlib.SigningMethodRS512, jwtlib.MapClaims{"data": "other"}).SignedString(j.privateKey)
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(other)
+	assert.Error(t, err)
+}
+
+// setPEMEnv encode une clé en PEM puis en base64 dans une variable d'environnement.
+func setPEMEnv(t *testing.T, name string, key interface{}, private bool) {
+	t.Helper()
+	var block *pem.Block
+	if private {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		assert.NoError(t, err)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	} else {
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshalPKIX(t, key)}
+	}
+	os.Setenv(name, base64.StdEncoding.EncodeToString(pem.EncodeToMemory(block)))
+	t.Cleanup(func() { os.Unsetenv(name) })
+}
+
+func mustMarshalPKIX(t *testing.T, key interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	assert.NoError(t, err)
+	return der
+}
@@ -0,0 +1,206 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCodeTTL = time.Minute
+	pkceMethodS256 = "S256"
+)
+
+// AuthorizeHandler retourne le endpoint d'autorisation OAuth 2.0 (RFC 6749, section 4.1)
+// avec PKCE obligatoire (RFC 7636, méthode S256 uniquement).
+//
+// resourceOwner identifie l'utilisateur qui autorise le client. Quand il n'est pas
+// authentifié, resourceOwner écrit lui-même la réponse (page de connexion, redirection)
+// et retourne ok à false. Sinon, un code à usage unique, valable le temps défini par
+// WithAuthorizationCodeTTL, est renvoyé au client sur son redirect_uri.
+//
+// Un client inconnu ou un redirect_uri non enregistré produisent une erreur 400 sans
+// redirection ; les autres erreurs sont renvoyées au client sur son redirect_uri.
+func (j *Tools) AuthorizeHandler(clients ClientRegistry, resourceOwner func(w http.ResponseWriter, r *http.Request) (subject string, ok bool)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+			writeOAuthJSON(w, http.StatusMethodNotAllowed, newOAuthError(http.StatusMethodNotAllowed, "invalid_request", "the authorization endpoint only accepts GET and POST"))
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, newOAuthError(http.StatusBadRequest, "invalid_request", "malformed request"))
+			return
+		}
+		client, err := clients.Client(r.Form.Get("client_id"))
+		if err != nil {
+			writeOAuthError(w, newOAuthError(http.StatusBadRequest, "invalid_request", "unknown client"))
+			return
+		}
+		requestedURI := r.Form.Get("redirect_uri")
+		redirectURI, ok := resolveRedirectURI(client, requestedURI)
+		if !ok {
+			writeOAuthError(w, newOAuthError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client"))
+			return
+		}
+
+		state := r.Form.Get("state")
+		scopes, oerr := authorizationRequest(client, r.Form)
+		if oerr != nil {
+			redirectWithParams(w, r, redirectURI, url.Values{"error": {oerr.Code}, "error_description": {oerr.Description}}, state)
+			return
+		}
+		subject, ok := resourceOwner(w, r)
+		if !ok {
+			return
+		}
+
+		code := &AuthorizationCode{
+			Code:          newID(),
+			ClientID:      client.ID,
+			RedirectURI:   requestedURI,
+			Subject:       subject,
+			Scope:         strings.Join(scopes, " "),
+			CodeChallenge: r.Form.Get("code_challenge"),
+			ExpiresAt:     j.now().Add(j.codeTTL),
+		}
+		if err := j.codeStore.Save(code); err != nil {
+			redirectWithParams(w, r, redirectURI, url.Values{"error": {"server_error"}}, state)
+			return
+		}
+		redirectWithParams(w, r, redirectURI, url.Values{"code": {code.Code}}, state)
+	})
+}
+
+// authorizationRequest vérifie les paramètres d'une demande d'autorisation et retourne les scopes accordés.
+func authorizationRequest(client *Client, form url.Values) ([]string, *oauthError) {
+	if responseType := form.Get("response_type"); responseType != "code" {
+		return nil, newOAuthError(http.StatusBadRequest, "unsupported_response_type", "only response_type=code is supported")
+	}
+	if !client.AllowsGrant(GrantAuthorizationCode) {
+		return nil, newOAuthError(http.StatusBadRequest, "unauthorized_client", "the client is not allowed to use this grant")
+	}
+	if form.Get("code_challenge_method") != pkceMethodS256 {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "code_challenge_method must be S256")
+	}
+	if !validPKCEValue(form.Get("code_challenge")) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "missing or malformed code_challenge")
+	}
+	return grantedScopes(form.Get("scope"), client.Scopes)
+}
+
+// resolveRedirectURI retourne l'URI de redirection demandée si elle est enregistrée pour le client,
+// ou l'unique URI enregistrée quand aucune n'est demandée. La comparaison est exacte.
+func resolveRedirectURI(client *Client, requested string) (string, bool) {
+	if requested == "" {
+		if len(client.RedirectURIs) == 1 {
+			return client.RedirectURIs[0], true
+		}
+		return "", false
+	}
+	return requested, slices.Contains(client.RedirectURIs, requested)
+}
+
+// redirectWithParams redirige vers redirectURI en ajoutant params et state à sa query.
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values, state string) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		writeOAuthError(w, newOAuthError(http.StatusBadRequest, "invalid_request", "malformed redirect_uri"))
+		return
+	}
+	query := target.Query()
+	for name, values := range params {
+		if values[0] != "" {
+			query.Set(name, values[0])
+		}
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	target.RawQuery = query.Encode()
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (j *Tools) authorizationCodeGrant(client *Client, form url.Values, jkt string) (*tokenResponse, *oauthError) {
+	codeValue, verifier := form.Get("code"), form.Get("code_verifier")
+	if codeValue == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "missing code")
+	}
+	if !validPKCEValue(verifier) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "missing or malformed code_verifier")
+	}
+	// Le code n'est consommé que par le client à qui il a été émis : un autre client ne peut pas l'invalider.
+	family := newID()
+	code, err := j.codeStore.Consume(codeValue, client.ID, family)
+	switch {
+	case errors.Is(err, ErrCodeReused):
+		// Un code rejoué a pu être intercepté : les tokens émis en échange sont révoqués (RFC 6749, section 4.1.2).
+		if err := j.refreshStore.RevokeFamily(code.Family); err != nil {
+			return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+		}
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+	case errors.Is(err, ErrCodeNotFound):
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+	case err != nil:
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+	}
+	switch {
+	case j.now().After(code.ExpiresAt):
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "authorization code expired")
+	case form.Get("redirect_uri") != code.RedirectURI:
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+	case !verifyCodeChallenge(verifier, code.CodeChallenge):
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code_challenge")
+	}
+
+	scopes := strings.Fields(code.Scope)
+	opts := []TokenOption{Subject(code.Subject), ClientID(client.ID)}
+	if len(scopes) > 0 {
+		opts = append(opts, Scopes(scopes...))
+	}
+	if jkt != "" {
+		opts = append(opts, DPoPKey(jkt))
+	}
+	pair, err := j.issuePair(nil, family, opts, nil)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+	}
+	return &tokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    tokenType(jkt),
+		ExpiresIn:    j.expiresIn(pair.AccessExpiresAt),
+		RefreshToken: pair.RefreshToken,
+		Scope:        code.Scope,
+	}, nil
+}
+
+// verifyCodeChallenge vérifie que BASE64URL(SHA256(verifier)) correspond au challenge (RFC 7636, section 4.6).
+func verifyCodeChallenge(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// validPKCEValue vérifie qu'un code_verifier ou code_challenge compte 43 à 128 caractères
+// non réservés (RFC 7636, section 4.1).
+func validPKCEValue(value string) bool {
+	if len(value) < 43 || len(value) > 128 {
+		return false
+	}
+	for _, c := range value {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package jwt
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+)
+
+var (
+	// ErrCodeNotFound est retournée quand un code d'autorisation est inconnu, expiré ou émis pour un autre client.
+	ErrCodeNotFound = errors.New("authorization code not found")
+	// ErrCodeReused est retournée quand un code d'autorisation déjà échangé est présenté à nouveau.
+	ErrCodeReused = errors.New("authorization code already used")
+)
+
+// CodeStore conserve les codes d'autorisation émis par AuthorizeHandler.
+type CodeStore interface {
+	// Save enregistre un code nouvellement émis.
+	Save(code *AuthorizationCode) error
+	// Consume marque comme échangé le code émis pour clientID, en y enregistrant la famille
+	// des tokens émis en échange, et le retourne. Un code inconnu ou émis pour un autre client
+	// n'est pas consommé et retourne ErrCodeNotFound. Un code ne peut être consommé qu'une fois :
+	// les appels suivants retournent le code, avec la famille enregistrée, et ErrCodeReused.
+	// Les codes échangés sont conservés jusqu'à leur expiration pour détecter ces rejeux.
+	Consume(code, clientID, family string) (*AuthorizationCode, error)
+}
+
+// AuthorizationCode décrit un code d'autorisation émis pour un client.
+type AuthorizationCode struct {
+	Code          string `gorm:"primaryKey"`
+	ClientID      string
+	RedirectURI   string // redirect_uri transmise à l'autorisation, vide si elle a été omise
+	Subject       string
+	Scope         string // scopes accordés, séparés par des espaces
+	CodeChallenge string // challenge PKCE S256
+	Family        string // famille des tokens émis en échange du code, vide tant qu'il n'a pas été échangé
+	ExpiresAt     time.Time
+}
+
+// MemoryCodeStore est un CodeStore en mémoire, adapté aux tests et aux instances uniques.
+type MemoryCodeStore struct {
+	mu      sync.Mutex
+	codes   map[string]*AuthorizationCode
+	sweeper memorySweeper
+	now     func() time.Time
+}
+
+// NewMemoryCodeStore crée un CodeStore en mémoire.
+func NewMemoryCodeStore() *MemoryCodeStore {
+	return &MemoryCodeStore{
+		codes: make(map[string]*AuthorizationCode),
+		now:   time.Now,
+	}
+}
+
+func (s *MemoryCodeStore) Save(code *AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := s.now(); s.sweeper.due(now) {
+		sweepExpired(s.codes, now, func(c *AuthorizationCode) time.Time { return c.ExpiresAt })
+	}
+	saved := *code
+	s.codes[code.Code] = &saved
+	return nil
+}
+
+func (s *MemoryCodeStore) Consume(code, clientID, family string) (*AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.codes[code]
+	if !ok || c.ClientID != clientID {
+		return nil, ErrCodeNotFound
+	}
+	if c.Family != "" {
+		used := *c
+		return &used, ErrCodeReused
+	}
+	c.Family = family
+	consumed := *c
+	return &consumed, nil
+}
+
+// GormCodeStore est un CodeStore persistant construit sur dbcrudops.
+type GormCodeStore struct {
+	operator *dbcrudops.Operator
+}
+
+// NewGormCodeStore crée un GormCodeStore et migre la table des codes d'autorisation.
+func NewGormCodeStore(operator *dbcrudops.Operator) (*GormCodeStore, error) {
+	if err := operator.Migrate(&AuthorizationCode{}); err != nil {
+		return nil, err
+	}
+	return &GormCodeStore{operator: operator}, nil
+}
+
+func (s *GormCodeStore) Save(code *AuthorizationCode) error {
+	return s.operator.Create(code)
+}
+
+func (s *GormCodeStore) Consume(code, clientID, family string) (*AuthorizationCode, error) {
+	// Seul l'appel qui enregistre effectivement la famille obtient le code.
+	updated := s.operator.GetDb().Model(&AuthorizationCode{}).
+		Where("code = ? AND client_id = ? AND (family = '' OR family IS NULL)", code, clientID).
+		Update("family", family)
+	if updated.Error != nil {
+		return nil, updated.Error
+	}
+	var record AuthorizationCode
+	found := s.operator.GetDb().Where("code = ? AND client_id = ?", code, clientID).Limit(1).Find(&record)
+	if found.Error != nil {
+		return nil, found.Error
+	}
+	if found.RowsAffected == 0 {
+		return nil, ErrCodeNotFound
+	}
+	if updated.RowsAffected == 0 {
+		return &record, ErrCodeReused
+	}
+	return &record, nil
+}
@@ -0,0 +1,286 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+// testChallenge est le challenge S256 de testVerifier (RFC 7636, annexe B).
+const testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+// authCodeServer expose les endpoints d'autorisation et de token. L'utilisateur est
+// authentifié par l'en-tête X-User ; sans lui, le serveur répond 401.
+type authCodeServer struct {
+	*httptest.Server
+	j *Tools
+}
+
+func newAuthCodeServer(t *testing.T, opts ...Option) *authCodeServer {
+	t.Helper()
+	j := New(time.Hour, opts...)
+	key := newTestTools(t, time.Hour)
+	j.OnError(func(error) {})
+	j.privateKey, j.publicKey = key.privateKey, key.publicKey
+
+	clients := newTestClientRegistry(t)
+	assert.NoError(t, clients.Register(Client{ID: "mobile", Public: true, Scopes: []string{"profile", "orders:read"}, RedirectURIs: []string{"com.example.app:/callback"}}, ""))
+	assert.NoError(t, clients.Register(Client{ID: "web", Scopes: []string{"profile"}, RedirectURIs: []string{"https://web.example/cb", "https://web.example/other"}}, "w3b"))
+
+	mux := http.NewServeMux()
+	mux.Handle("/authorize", j.AuthorizeHandler(clients, func(w http.ResponseWriter, r *http.Request) (string, bool) {
+		user := r.Header.Get("X-User")
+		if user == "" {
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return "", false
+		}
+		return user, true
+	}))
+	mux.Handle("/token", j.TokenHandler(clients))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return &authCodeServer{Server: server, j: j}
+}
+
+// authorize appelle le endpoint d'autorisation sans suivre la redirection.
+func (s *authCodeServer) authorize(t *testing.T, params url.Values) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/authorize?"+params.Encode(), nil)
+	assert.NoError(t, err)
+	req.Header.Set("X-User", "user-1")
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
+
+// code obtient un code d'autorisation pour le client public.
+func (s *authCodeServer) code(t *testing.T) string {
+	t.Helper()
+	resp := s.authorize(t, mobileAuthorization())
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	return location.Query().Get("code")
+}
+
+// token poste le formulaire au endpoint de token et décode la réponse.
+func (s *authCodeServer) token(t *testing.T, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+	resp, err := http.PostForm(s.URL+"/token", form)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+func mobileAuthorization() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"mobile"},
+		"redirect_uri":          {"com.example.app:/callback"},
+		"scope":                 {"profile"},
+		"state":                 {"xyz"},
+		"code_challenge":        {testChallenge},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func codeExchange(code string) url.Values {
+	return url.Values{
+		"grant_type":    {GrantAuthorizationCode},
+		"client_id":     {"mobile"},
+		"code":          {code},
+		"redirect_uri":  {"com.example.app:/callback"},
+		"code_verifier": {testVerifier},
+	}
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	assert.True(t, verifyCodeChallenge(testVerifier, testChallenge))
+	assert.False(t, verifyCodeChallenge(testVerifier+"x", testChallenge))
+
+	sum := sha256.Sum256([]byte(testVerifier))
+	assert.Equal(t, testChallenge, base64.RawURLEncoding.EncodeToString(sum[:]))
+	assert.False(t, validPKCEValue("short"))
+	assert.False(t, validPKCEValue(strings.Repeat("a", 129)))
+	assert.False(t, validPKCEValue(strings.Repeat("a", 42)+"+"))
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	s := newAuthCodeServer(t)
+
+	status, body := s.token(t, codeExchange(s.code(t)))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Bearer", body["token_type"])
+	assert.Equal(t, "profile", body["scope"])
+	assert.NotEmpty(t, body["refresh_token"])
+
+	claims, err := s.j.ValidateToken(body["access_token"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims["sub"])
+	assert.Equal(t, "mobile", claims[clientIDClaim])
+	assert.Equal(t, []string{"profile"}, ScopesOf(claims))
+
+	// Le client public renouvelle ses tokens avec son seul client_id.
+	status, body = s.token(t, url.Values{
+		"grant_type":    {GrantRefreshToken},
+		"client_id":     {"mobile"},
+		"refresh_token": {body["refresh_token"].(string)},
+	})
+	assert.Equal(t, http.StatusOK, status)
+	claims, err = s.j.ValidateToken(body["access_token"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims["sub"])
+
+	// Un client public ne peut pas utiliser client_credentials.
+	status, body = s.token(t, url.Values{"grant_type": {GrantClientCredentials}, "client_id": {"mobile"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "unauthorized_client", body["error"])
+}
+
+func TestAuthorizationCodeRejected(t *testing.T) {
+	s := newAuthCodeServer(t, WithAuthorizationCodeTTL(time.Minute))
+
+	tests := []struct {
+		name   string
+		modify func(form url.Values)
+		error  string
+	}{
+		{"wrong verifier", func(form url.Values) { form.Set("code_verifier", strings.Repeat("a", 43)) }, "invalid_grant"},
+		{"missing verifier", func(form url.Values) { form.Del("code_verifier") }, "invalid_request"},
+		{"redirect mismatch", func(form url.Values) { form.Set("redirect_uri", "com.example.app:/other") }, "invalid_grant"},
+		{"unknown code", func(form url.Values) { form.Set("code", "unknown") }, "invalid_grant"},
+		{"confidential client", func(form url.Values) { form.Set("client_id", "web"); form.Set("client_secret", "w3b") }, "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := codeExchange(s.code(t))
+			tt.modify(form)
+			status, body := s.token(t, form)
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.Equal(t, tt.error, body["error"])
+		})
+	}
+
+	t.Run("another client", func(t *testing.T) {
+		// Le code présenté par un autre client n'est pas consommé.
+		form := codeExchange(s.code(t))
+		other := codeExchange(form.Get("code"))
+		other.Set("client_id", "web")
+		other.Set("client_secret", "w3b")
+		status, _ := s.token(t, other)
+		assert.Equal(t, http.StatusBadRequest, status)
+		status, _ = s.token(t, form)
+		assert.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("reused code", func(t *testing.T) {
+		form := codeExchange(s.code(t))
+		status, issued := s.token(t, form)
+		assert.Equal(t, http.StatusOK, status)
+		status, body := s.token(t, form)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "invalid_grant", body["error"])
+
+		// Le rejeu révoque les tokens émis en échange du code.
+		status, body = s.token(t, url.Values{
+			"grant_type":    {GrantRefreshToken},
+			"client_id":     {"mobile"},
+			"refresh_token": {issued["refresh_token"].(string)},
+		})
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "invalid_grant", body["error"])
+	})
+
+	t.Run("expired code", func(t *testing.T) {
+		form := codeExchange(s.code(t))
+		s.j.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		defer func() { s.j.now = time.Now }()
+		status, body := s.token(t, form)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "invalid_grant", body["error"])
+	})
+}
+
+func TestAuthorizeHandlerErrors(t *testing.T) {
+	s := newAuthCodeServer(t)
+
+	// Sans redirect_uri valide, l'erreur est affichée et non redirigée.
+	for _, params := range []url.Values{
+		{"client_id": {"unknown"}},
+		{"client_id": {"mobile"}, "redirect_uri": {"https://evil.example/cb"}},
+		{"client_id": {"web"}}, // plusieurs URI enregistrées : redirect_uri est obligatoire
+	} {
+		resp := s.authorize(t, params)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// Les autres erreurs sont renvoyées au client avec son state.
+	tests := []struct {
+		name   string
+		modify func(params url.Values)
+		error  string
+	}{
+		{"response type", func(params url.Values) { params.Set("response_type", "token") }, "unsupported_response_type"},
+		{"plain method", func(params url.Values) { params.Set("code_challenge_method", "plain") }, "invalid_request"},
+		{"missing challenge", func(params url.Values) { params.Del("code_challenge") }, "invalid_request"},
+		{"scope", func(params url.Values) { params.Set("scope", "admin") }, "invalid_scope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := mobileAuthorization()
+			params.Del("redirect_uri") // l'unique URI enregistrée est utilisée
+			tt.modify(params)
+			resp := s.authorize(t, params)
+			assert.Equal(t, http.StatusFound, resp.StatusCode)
+			location, err := resp.Location()
+			assert.NoError(t, err)
+			assert.Equal(t, "com.example.app:/callback", location.Scheme+":"+location.Opaque+location.Path)
+			assert.Equal(t, tt.error, location.Query().Get("error"))
+			assert.Equal(t, "xyz", location.Query().Get("state"))
+			assert.Empty(t, location.Query().Get("code"))
+		})
+	}
+
+	// Un utilisateur non authentifié reçoit la réponse de resourceOwner.
+	resp, err := http.Get(s.URL + "/authorize?" + mobileAuthorization().Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestGormCodeStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	assert.NoError(t, err)
+	operator := dbcrudops.New(db)
+	operator.OnError(func(error) {})
+	store, err := NewGormCodeStore(operator)
+	assert.NoError(t, err)
+
+	s := newAuthCodeServer(t, WithCodeStore(store))
+	form := codeExchange(s.code(t))
+	status, _ := s.token(t, form)
+	assert.Equal(t, http.StatusOK, status)
+	_, err = store.Consume(form.Get("code"), "web", newID())
+	assert.ErrorIs(t, err, ErrCodeNotFound)
+	code, err := store.Consume(form.Get("code"), "mobile", newID())
+	assert.ErrorIs(t, err, ErrCodeReused)
+	assert.NotEmpty(t, code.Family)
+}
@@ -0,0 +1,42 @@
+package jwt
+
+import (
+	"slices"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// validateClaims vérifie les claims enregistrés d'un token dont la signature est valide.
+// Les dates sont comparées à l'horloge de l'instance, avec la tolérance configurée.
+func (j *Tools) validateClaims(claims jwt.MapClaims, cfg *validateConfig) error {
+	now := j.now()
+	if !claims.VerifyExpiresAt(now.Add(-cfg.leeway).Unix(), false) {
+		return jwt.NewValidationError("Token is expired", jwt.ValidationErrorExpired)
+	}
+	if !claims.VerifyIssuedAt(now.Add(cfg.leeway).Unix(), false) {
+		return jwt.NewValidationError("Token used before issued", jwt.ValidationErrorIssuedAt)
+	}
+	if !claims.VerifyNotBefore(now.Add(cfg.leeway).Unix(), false) {
+		return jwt.NewValidationError("Token is not valid yet", jwt.ValidationErrorNotValidYet)
+	}
+	if len(cfg.issuers) > 0 {
+		issuer, _ := claims["iss"].(string)
+		if !slices.Contains(cfg.issuers, issuer) {
+			return jwt.NewValidationError("Token has an unexpected issuer", jwt.ValidationErrorIssuer)
+		}
+	}
+	if len(cfg.audiences) > 0 && !audienceMatches(claims["aud"], cfg.audiences) {
+		return jwt.NewValidationError("Token has an unexpected audience", jwt.ValidationErrorAudience)
+	}
+	return nil
+}
+
+// audienceMatches indique si le claim aud, chaîne ou tableau, contient une des audiences attendues.
+func audienceMatches(aud interface{}, expected []string) bool {
+	for _, value := range stringsClaim(aud) {
+		if slices.Contains(expected, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisteredClaims(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	j.issuer = "https://auth.example.com"
+	j.audience = []string{"api"}
+
+	// Test
+	token, err := j.GenerateToken("testData", Subject("user-42"), Audience("api", "admin"))
+	assert.NoError(t, err)
+	other, err := j.GenerateToken("testData")
+	assert.NoError(t, err)
+
+	// Assert
+	claims := unverifiedClaims(t, token)
+	assert.Equal(t, "https://auth.example.com", claims["iss"])
+	assert.Equal(t, "user-42", claims["sub"])
+	assert.Equal(t, []interface{}{"api", "admin"}, claims["aud"])
+	assert.NotEmpty(t, claims["jti"])
+	assert.NotEqual(t, claims["jti"], unverifiedClaims(t, other)["jti"])
+	assert.Equal(t, "api", unverifiedClaims(t, other)["aud"])
+}
+
+func TestValidateIssuerAndAudience(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	j.expectedIssuers = []string{"https://auth.example.com"}
+	j.expectedAudiences = []string{"api"}
+
+	valid, err := j.GenerateToken("testData", Issuer("https://auth.example.com"), Audience("api", "admin"))
+	assert.NoError(t, err)
+	wrongIssuer, err := j.GenerateToken("testData", Issuer("https://evil.example.com"), Audience("api"))
+	assert.NoError(t, err)
+	wrongAudience, err := j.GenerateToken("testData", Issuer("https://auth.example.com"), Audience("billing"))
+	assert.NoError(t, err)
+
+	// Test & Assert
+	_, err = j.ValidateToken(valid)
+	assert.NoError(t, err)
+
+	_, err = j.ValidateToken(wrongIssuer)
+	assertValidationError(t, err, jwtlib.ValidationErrorIssuer)
+
+	_, err = j.ValidateToken(wrongAudience)
+	assertValidationError(t, err, jwtlib.ValidationErrorAudience)
+
+	// Per-call expectations override the instance ones.
+	_, err = j.ValidateToken(wrongAudience, ExpectAudiences("billing"))
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(valid, ExpectIssuers("https://other.example.com"))
+	assertValidationError(t, err, jwtlib.ValidationErrorIssuer)
+}
+
+func TestValidateLeeway(t *testing.T) {
+	// Setup
+	now := time.Unix(1700000000, 0)
+	j := newTestTools(t, time.Minute)
+	j.now = func() time.Time { return now }
+	token, err := j.GenerateToken("testData")
+	assert.NoError(t, err)
+	future, err := j.GenerateToken("testData", NotBefore(now.Add(10*time.Second)))
+	assert.NoError(t, err)
+
+	// Test: one minute and five seconds later the token is expired...
+	now = now.Add(65 * time.Second)
+	_, err = j.ValidateToken(token)
+	assertValidationError(t, err, jwtlib.ValidationErrorExpired)
+
+	// ...unless the clock skew is tolerated.
+	j.leeway = 10 * time.Second
+	_, err = j.ValidateToken(token)
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(token, Leeway(0))
+	assertValidationError(t, err, jwtlib.ValidationErrorExpired)
+
+	// nbf also honours the leeway.
+	now = time.Unix(1700000000, 0)
+	_, err = j.ValidateToken(future, Leeway(0))
+	assertValidationError(t, err, jwtlib.ValidationErrorNotValidYet)
+	_, err = j.ValidateToken(future)
+	assert.NoError(t, err)
+}
+
+// assertValidationError vérifie que err est une *jwt.ValidationError portant le drapeau donné.
+func assertValidationError(t *testing.T, err error, flag uint32) {
+	t.Helper()
+	var validationErr *jwtlib.ValidationError
+	if assert.True(t, errors.As(err, &validationErr), "expected a validation error, got %v", err) {
+		assert.NotZero(t, validationErr.Errors&flag, "unexpected validation error %v", err)
+	}
+}
+
+func TestReservedClaims(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	for _, name := range []string{"exp", "iat", "jti", "iss", "token_use", "cnf", "sid", "auth_time"} {
+		_, err := j.GenerateToken("data", Claim(name, "forged"))
+		assert.Error(t, err, name)
+	}
+	_, err := j.IssueTokenPair("data", Claim("fam", "forged"))
+	assert.Error(t, err)
+
+	token, err := j.GenerateToken("data", Claim("tenant_name", "acme"))
+	assert.NoError(t, err)
+	claims, err := j.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", claims["tenant_name"])
+}
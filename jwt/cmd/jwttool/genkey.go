@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+)
+
+// genkey génère une paire de clés. Sans -out, elle écrit les deux clés en PEM encodé en base64,
+// prêtes à être placées dans un fichier .env ; avec -out, elle écrit les fichiers PEM
+// <out> (clé privée) et <out>.pub (clé publique).
+func genkey(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("genkey", stderr)
+	keyType := fs.String("type", "rsa", "key type: rsa, ec or ed25519")
+	bits := fs.Int("bits", 2048, "RSA key size in bits")
+	curve := fs.String("curve", "P-256", "EC curve: P-256, P-384 or P-521")
+	out := fs.String("out", "", "write PEM files <out> and <out>.pub instead of printing environment variables")
+	privateEnv := fs.String("private-env", "PRIVATE_KEY", "name of the private key variable")
+	publicEnv := fs.String("public-env", "PUBLIC_KEY", "name of the public key variable")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	privateKey, err := generateKey(*keyType, *bits, *curve)
+	if err != nil {
+		return err
+	}
+	privatePEM, publicPEM, err := encodeKeyPair(privateKey)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		if err := os.WriteFile(*out, privatePEM, 0o600); err != nil {
+			return err
+		}
+		if err := os.WriteFile(*out+".pub", publicPEM, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "wrote %s and %s.pub\n", *out, *out)
+		return nil
+	}
+	fmt.Fprintf(stdout, "%s=%s\n", *privateEnv, base64.StdEncoding.EncodeToString(privatePEM))
+	fmt.Fprintf(stdout, "%s=%s\n", *publicEnv, base64.StdEncoding.EncodeToString(publicPEM))
+	return nil
+}
+
+func generateKey(keyType string, bits int, curve string) (crypto.Signer, error) {
+	switch keyType {
+	case "rsa":
+		if bits < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	case "ec":
+		var c elliptic.Curve
+		switch curve {
+		case "P-256":
+			c = elliptic.P256()
+		case "P-384":
+			c = elliptic.P384()
+		case "P-521":
+			c = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", curve)
+		}
+		return ecdsa.GenerateKey(c, rand.Reader)
+	case "ed25519":
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
+
+// encodeKeyPair encode la clé privée en PKCS#8 et la clé publique en PKIX, au format PEM.
+func encodeKeyPair(privateKey crypto.Signer) ([]byte, []byte, error) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), nil
+}
@@ -0,0 +1,65 @@
+// Commande jwttool : génère des paires de clés au format attendu par LoadPrivateKeyFromEnv,
+// émet, décode et vérifie des tokens sans passer par un site web.
+//
+//	jwttool genkey [-type rsa|ec|ed25519] [-out fichier]
+//	jwttool mint   -key fichier|-key-env NOM [-sub ...] [-claim nom=valeur ...]
+//	jwttool decode token
+//	jwttool verify -key fichier|-key-env NOM|-jwks URL [-iss ...] [-aud ...] token
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: jwttool <command> [flags]
+
+commands:
+  genkey   generate an RSA, EC or Ed25519 key pair (base64 PEM, as LoadPrivateKeyFromEnv expects)
+  mint     sign a token with the given claims
+  decode   print the header and claims of a token without verifying it
+  verify   verify a token against a key file or a JWKS and report each claim check
+
+Run "jwttool <command> -h" for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run exécute la commande et retourne le code de sortie du processus.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "genkey":
+		err = genkey(args[1:], stdout, stderr)
+	case "mint":
+		err = mint(args[1:], stdout, stderr)
+	case "decode":
+		err = decode(args[1:], stdin, stdout, stderr)
+	case "verify":
+		var valid bool
+		if valid, err = verify(args[1:], stdin, stdout, stderr); err == nil && !valid {
+			return 1
+		}
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "jwttool: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	if err != nil {
+		if err == errUsage {
+			return 2
+		}
+		fmt.Fprintln(stderr, "jwttool:", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/abdotop/tools/jwt"
+)
+
+// runTool exécute jwttool et retourne son code de sortie et sa sortie standard.
+func runTool(t *testing.T, stdin string, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	if code != 0 {
+		t.Logf("stderr: %s", stderr.String())
+	}
+	return code, stdout.String()
+}
+
+// envKeys génère une paire de clés et place les variables affichées dans l'environnement.
+func envKeys(t *testing.T, keyType string) {
+	t.Helper()
+	code, out := runTool(t, "", "genkey", "-type", keyType)
+	assert.Equal(t, 0, code)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 2)
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, "=")
+		assert.True(t, ok)
+		t.Setenv(name, value)
+	}
+}
+
+func TestGenkeyLoadsFromEnv(t *testing.T) {
+	for _, keyType := range []string{"rsa", "ec", "ed25519"} {
+		t.Run(keyType, func(t *testing.T) {
+			envKeys(t, keyType)
+			tools := jwt.New(time.Hour)
+			tools.OnError(func(error) {})
+			assert.NoError(t, tools.LoadPrivateKeyFromEnv("PRIVATE_KEY"))
+			assert.NoError(t, tools.LoadPublicKeyFromEnv("PUBLIC_KEY"))
+			token, err := tools.GenerateToken("data")
+			assert.NoError(t, err)
+			_, err = tools.ValidateToken(token)
+			assert.NoError(t, err)
+		})
+	}
+
+	code, _ := runTool(t, "", "genkey", "-type", "dsa")
+	assert.Equal(t, 1, code)
+}
+
+func TestMintDecodeVerify(t *testing.T) {
+	envKeys(t, "ec")
+	code, token := runTool(t, "", "mint", "-key-env", "PRIVATE_KEY", "-sub", "user-1", "-iss", "auth",
+		"-aud", "api", "-claim", "role=admin", "-claim", "level=3", "-data", `{"plan":"pro"}`)
+	assert.Equal(t, 0, code)
+	token = strings.TrimSpace(token)
+
+	code, out := runTool(t, token+"\n", "decode", "-")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, `"alg": "ES256"`)
+	assert.Contains(t, out, `"sub": "user-1"`)
+	assert.Contains(t, out, `"role": "admin"`)
+	assert.Contains(t, out, `"level": 3`)
+	assert.Contains(t, out, `"plan": "pro"`)
+	assert.Contains(t, out, "exp: ")
+	assert.Regexp(t, `exp: \S+ \(in (1h0m0s|59m5\ds)\)`, out)
+
+	code, out = runTool(t, "", "verify", "-key-env", "PUBLIC_KEY", "-iss", "auth", "-aud", "api", token)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "ok   signature  alg=ES256")
+	assert.Contains(t, out, "ok   iss")
+	assert.Contains(t, out, "result: valid")
+
+	// Une attente non satisfaite est signalée sur sa ligne.
+	code, out = runTool(t, "", "verify", "-key-env", "PUBLIC_KEY", "-aud", "billing", token)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out, "FAIL aud")
+	assert.Contains(t, out, "result: invalid")
+
+	// Une autre clé fait échouer la signature.
+	dir := t.TempDir()
+	other := filepath.Join(dir, "other.pem")
+	code, _ = runTool(t, "", "genkey", "-type", "ec", "-out", other)
+	assert.Equal(t, 0, code)
+	code, out = runTool(t, "", "verify", "-key", other+".pub", token)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out, "FAIL signature")
+}
+
+func TestVerifyExpiredWithJWKS(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "signing.pem")
+	code, _ := runTool(t, "", "genkey", "-type", "ed25519", "-out", keyFile)
+	assert.Equal(t, 0, code)
+
+	issuer := jwt.New(time.Hour)
+	issuer.OnError(func(error) {})
+	assert.NoError(t, issuer.LoadKeySource(jwt.FileKeySource{Path: keyFile}))
+	server := httptest.NewServer(issuer.JWKSHandler())
+	defer server.Close()
+
+	// Un token émis il y a deux heures, valable une minute.
+	past := jwt.New(time.Minute, jwt.WithClock(func() time.Time { return time.Now().Add(-2 * time.Hour) }))
+	past.OnError(func(error) {})
+	assert.NoError(t, past.LoadKeySource(jwt.FileKeySource{Path: keyFile}))
+	token, err := past.GenerateToken(nil)
+	assert.NoError(t, err)
+
+	code, out := runTool(t, "", "verify", "-jwks", server.URL, token)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out, "ok   signature  alg=EdDSA")
+	assert.Contains(t, out, "FAIL exp")
+	assert.Contains(t, out, "ago)")
+	assert.Contains(t, out, "result: invalid")
+}
+
+func TestUsage(t *testing.T) {
+	code, _ := runTool(t, "")
+	assert.Equal(t, 2, code)
+	code, _ = runTool(t, "", "unknown")
+	assert.Equal(t, 2, code)
+	code, _ = runTool(t, "", "mint")
+	assert.Equal(t, 1, code)
+	code, _ = runTool(t, "", "decode", "not-a-token")
+	assert.Equal(t, 1, code)
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+
+	"github.com/abdotop/tools/jwt"
+)
+
+// errUsage signale des arguments invalides, déjà expliqués par le FlagSet.
+var errUsage = errors.New("usage")
+
+// century sert de leeway pour vérifier la signature indépendamment des dates du token.
+const century = 100 * 365 * 24 * time.Hour
+
+// listFlag est un flag répétable.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("jwttool "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// keyFlags sont les options de choix de la clé, communes à mint et verify.
+type keyFlags struct {
+	file, env string
+}
+
+func (k *keyFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&k.file, "key", "", "key file (PEM, DER or base64 PEM)")
+	fs.StringVar(&k.env, "key-env", "", "environment variable holding a base64 PEM key")
+}
+
+func (k *keyFlags) source() (jwt.KeySource, bool) {
+	switch {
+	case k.file != "":
+		return jwt.FileKeySource{Path: k.file}, true
+	case k.env != "":
+		return jwt.EnvKeySource{Name: k.env}, true
+	default:
+		return nil, false
+	}
+}
+
+// newTools crée une instance dont les erreurs sont retournées sans être publiées.
+func newTools(ttl time.Duration, opts ...jwt.Option) *jwt.Tools {
+	tools := jwt.New(ttl, opts...)
+	tools.OnError(func(error) {})
+	return tools
+}
+
+// mint signe un token et l'écrit sur la sortie standard.
+func mint(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("mint", stderr)
+	var key keyFlags
+	key.register(fs)
+	ttl := fs.Duration("ttl", time.Hour, "token lifetime")
+	subject := fs.String("sub", "", "subject (sub)")
+	issuer := fs.String("iss", "", "issuer (iss)")
+	var audiences, claims listFlag
+	fs.Var(&audiences, "aud", "audience (aud), repeatable")
+	fs.Var(&claims, "claim", "custom claim name=value, repeatable; JSON values are decoded")
+	data := fs.String("data", "", "JSON value of the data claim")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	src, ok := key.source()
+	if !ok {
+		return errors.New("mint: -key or -key-env is required")
+	}
+
+	tools := newTools(*ttl)
+	if err := tools.LoadKeySource(src); err != nil {
+		return err
+	}
+	var opts []jwt.TokenOption
+	if *subject != "" {
+		opts = append(opts, jwt.Subject(*subject))
+	}
+	if *issuer != "" {
+		opts = append(opts, jwt.Issuer(*issuer))
+	}
+	if len(audiences) > 0 {
+		opts = append(opts, jwt.Audience(audiences...))
+	}
+	for _, claim := range claims {
+		name, value, ok := strings.Cut(claim, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("mint: invalid claim %q, expected name=value", claim)
+		}
+		opts = append(opts, jwt.Claim(name, jsonOrString(value)))
+	}
+	var payload interface{}
+	if *data != "" {
+		if err := json.Unmarshal([]byte(*data), &payload); err != nil {
+			return fmt.Errorf("mint: -data is not valid JSON: %w", err)
+		}
+	}
+
+	token, err := tools.GenerateToken(payload, opts...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, token)
+	return nil
+}
+
+// decode affiche l'en-tête et les claims d'un token sans vérifier sa signature.
+func decode(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("decode", stderr)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	tokenString, err := tokenArg(fs, stdin)
+	if err != nil {
+		return err
+	}
+	token, claims, err := parseUnverified(tokenString)
+	if err != nil {
+		return err
+	}
+	if err := printJSON(stdout, "header", token.Header); err != nil {
+		return err
+	}
+	if err := printJSON(stdout, "claims", claims); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, name := range []string{"exp", "nbf", "iat"} {
+		if t, ok := timeClaim(claims, name); ok {
+			fmt.Fprintf(stdout, "%s: %s\n", name, describeTime(t, now))
+		}
+	}
+	return nil
+}
+
+// verify vérifie un token et affiche le résultat de chaque contrôle. Elle retourne false
+// si le token est refusé.
+func verify(args []string, stdin io.Reader, stdout, stderr io.Writer) (bool, error) {
+	fs := newFlagSet("verify", stderr)
+	var key keyFlags
+	key.register(fs)
+	jwksURL := fs.String("jwks", "", "JWKS URL to fetch verification keys from")
+	var issuers, audiences listFlag
+	fs.Var(&issuers, "iss", "accepted issuer, repeatable")
+	fs.Var(&audiences, "aud", "accepted audience, repeatable")
+	leeway := fs.Duration("leeway", 0, "clock skew tolerance for exp, nbf and iat")
+	if err := parseFlags(fs, args); err != nil {
+		return false, err
+	}
+	tokenString, err := tokenArg(fs, stdin)
+	if err != nil {
+		return false, err
+	}
+	token, claims, err := parseUnverified(tokenString)
+	if err != nil {
+		return false, err
+	}
+
+	var tools *jwt.Tools
+	if src, ok := key.source(); ok {
+		tools = newTools(time.Hour)
+		if err := tools.LoadKeySource(src); err != nil {
+			return false, err
+		}
+	} else if *jwksURL != "" {
+		tools = newTools(time.Hour, jwt.WithJWKSClient(jwt.NewJWKSClient(*jwksURL)))
+	} else {
+		return false, errors.New("verify: -key, -key-env or -jwks is required")
+	}
+
+	// La signature est vérifiée seule, puis le token complet avec les attentes demandées.
+	_, err = tools.ValidateToken(tokenString, jwt.Leeway(century))
+	kid, _ := token.Header["kid"].(string)
+	if signatureFailed(err) {
+		fmt.Fprintf(stdout, "FAIL signature  alg=%v kid=%s: %v\n", token.Header["alg"], kid, err)
+	} else {
+		fmt.Fprintf(stdout, "ok   signature  alg=%v kid=%s\n", token.Header["alg"], kid)
+	}
+	for _, check := range claimChecks(claims, time.Now(), *leeway, issuers, audiences) {
+		fmt.Fprintln(stdout, check)
+	}
+
+	opts := []jwt.ValidateOption{jwt.Leeway(*leeway)}
+	if len(issuers) > 0 {
+		opts = append(opts, jwt.ExpectIssuers(issuers...))
+	}
+	if len(audiences) > 0 {
+		opts = append(opts, jwt.ExpectAudiences(audiences...))
+	}
+	if _, err := tools.ValidateToken(tokenString, opts...); err != nil {
+		fmt.Fprintf(stdout, "result: invalid: %v\n", err)
+		return false, nil
+	}
+	fmt.Fprintln(stdout, "result: valid")
+	return true, nil
+}
+
+// signatureFailed indique si l'erreur de validation concerne la signature ou la clé,
+// et non les claims.
+func signatureFailed(err error) bool {
+	var tokenErr *jwt.TokenError
+	switch {
+	case err == nil:
+		return false
+	case !errors.As(err, &tokenErr):
+		return true
+	}
+	return errors.Is(err, jwt.ErrTokenSignatureInvalid) ||
+		errors.Is(err, jwt.ErrTokenMalformed) ||
+		errors.Is(err, jwt.ErrTokenUnverifiable) ||
+		errors.Is(err, jwt.ErrUnknownKeyID)
+}
+
+// claimChecks décrit le contrôle de chaque claim enregistré, une ligne par claim.
+func claimChecks(claims jwtlib.MapClaims, now time.Time, leeway time.Duration, issuers, audiences []string) []string {
+	var lines []string
+	line := func(ok bool, name, detail string) {
+		status := "ok  "
+		if !ok {
+			status = "FAIL"
+		}
+		lines = append(lines, fmt.Sprintf("%s %-10s %s", status, name, detail))
+	}
+
+	if exp, ok := timeClaim(claims, "exp"); ok {
+		line(now.Add(-leeway).Before(exp), "exp", describeTime(exp, now))
+	} else {
+		line(true, "exp", "absent: the token never expires")
+	}
+	if nbf, ok := timeClaim(claims, "nbf"); ok {
+		line(!nbf.After(now.Add(leeway)), "nbf", describeTime(nbf, now))
+	}
+	if iat, ok := timeClaim(claims, "iat"); ok {
+		line(!iat.After(now.Add(leeway)), "iat", describeTime(iat, now))
+	}
+
+	issuer, _ := claims["iss"].(string)
+	switch {
+	case len(issuers) > 0:
+		line(slices.Contains(issuers, issuer), "iss", fmt.Sprintf("%q, expected one of %q", issuer, issuers))
+	case issuer != "":
+		line(true, "iss", fmt.Sprintf("%q, not checked", issuer))
+	}
+	tokenAudiences := audienceClaim(claims["aud"])
+	switch {
+	case len(audiences) > 0:
+		matched := slices.ContainsFunc(tokenAudiences, func(aud string) bool { return slices.Contains(audiences, aud) })
+		line(matched, "aud", fmt.Sprintf("%q, expected one of %q", tokenAudiences, audiences))
+	case len(tokenAudiences) > 0:
+		line(true, "aud", fmt.Sprintf("%q, not checked", tokenAudiences))
+	}
+	return lines
+}
+
+// describeTime formate une date et sa distance à maintenant, par exemple
+// « 2024-06-01T12:00:00Z (in 59m30s) » ou « 2024-06-01T10:00:00Z (2h0m0s ago) ».
+func describeTime(t, now time.Time) string {
+	d := t.Sub(now).Round(time.Second)
+	relative := "now"
+	switch {
+	case d > 0:
+		relative = "in " + d.String()
+	case d < 0:
+		relative = (-d).String() + " ago"
+	}
+	return fmt.Sprintf("%s (%s)", t.UTC().Format(time.RFC3339), relative)
+}
+
+func timeClaim(claims jwtlib.MapClaims, name string) (time.Time, bool) {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+func audienceClaim(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var audiences []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+		return audiences
+	}
+	return nil
+}
+
+func parseUnverified(tokenString string) (*jwtlib.Token, jwtlib.MapClaims, error) {
+	claims := jwtlib.MapClaims{}
+	token, _, err := jwtlib.NewParser().ParseUnverified(tokenString, claims)
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed token: %w", err)
+	}
+	return token, claims, nil
+}
+
+// tokenArg lit le token en argument, ou sur l'entrée standard si l'argument est absent ou vaut « - ».
+func tokenArg(fs *flag.FlagSet, stdin io.Reader) (string, error) {
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		if fs.Arg(0) != "-" {
+			return fs.Arg(0), nil
+		}
+	default:
+		return "", errors.New("expected a single token")
+	}
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return "", errors.New("no token given")
+	}
+	return line, nil
+}
+
+func printJSON(w io.Writer, title string, value interface{}) error {
+	encoded, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s:\n%s\n", title, encoded)
+	return err
+}
+
+// jsonOrString décode une valeur JSON (nombre, booléen, tableau, objet) ou retourne la chaîne telle quelle.
+func jsonOrString(value string) interface{} {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+		return decoded
+	}
+	return value
+}
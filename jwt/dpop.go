@@ -0,0 +1,225 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	dpopProofType = "dpop+jwt"
+	cnfClaim      = "cnf"
+
+	defaultDPoPProofMaxAge = 5 * time.Minute
+	// dpopClockSkew tolère une horloge cliente légèrement en avance.
+	dpopClockSkew = 30 * time.Second
+)
+
+var (
+	// ErrInvalidDPoPProof est retournée quand une preuve DPoP est absente, mal formée
+	// ou ne correspond pas à la requête.
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+	// ErrTokenBindingMismatch est la raison du refus d'un token lié à une clé DPoP présenté
+	// sans preuve de cette clé, ou d'un token non lié présenté avec une preuve.
+	ErrTokenBindingMismatch = errors.New("token binding does not match the DPoP proof")
+)
+
+// DPoPKey lie le token à la clé du client (claim cnf.jkt, RFC 9449 section 6) :
+// il ne sera accepté qu'accompagné d'une preuve DPoP signée par cette clé.
+// jkt est l'empreinte RFC 7638 de la clé publique, voir JWK.Thumbprint.
+func DPoPKey(jkt string) TokenOption {
+	return withClaim(cnfClaim, map[string]interface{}{"jkt": jkt})
+}
+
+// NewDPoPProof crée une preuve DPoP (RFC 9449 section 4) signée par la clé privée du client
+// pour la requête method sur targetURL. accessToken est vide pour une requête au endpoint de token.
+func NewDPoPProof(privateKey crypto.PrivateKey, method, targetURL, accessToken string) (string, error) {
+	signer, err := signingMethod(privateKey)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := privateKey.([]byte); ok {
+		return "", errors.New("DPoP proofs require an asymmetric key")
+	}
+	publicKey, err := publicKeyOf(privateKey)
+	if err != nil {
+		return "", err
+	}
+	jwk, err := NewJWK("", publicKey)
+	if err != nil {
+		return "", err
+	}
+	jwk.Use, jwk.Alg = "", ""
+	claims := jwt.MapClaims{
+		"jti": newID(),
+		"htm": method,
+		"htu": targetURL,
+		"iat": time.Now().Unix(),
+	}
+	if accessToken != "" {
+		claims["ath"] = accessTokenHash(accessToken)
+	}
+	token := jwt.NewWithClaims(signer, claims)
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = jwk
+	return token.SignedString(privateKey)
+}
+
+// VerifyDPoPProof vérifie une preuve DPoP pour la requête method sur targetURL et retourne
+// l'empreinte (jkt) de la clé qui l'a signée. Quand accessToken n'est pas vide, la preuve
+// doit porter son empreinte (claim ath). Chaque preuve n'est acceptée qu'une fois.
+func (j *Tools) VerifyDPoPProof(proof, method, targetURL, accessToken string) (string, error) {
+	jkt, err := j.verifyDPoPProof(proof, method, targetURL, accessToken)
+	if err != nil {
+		j.errChan <- err
+		return "", err
+	}
+	return jkt, nil
+}
+
+func (j *Tools) verifyDPoPProof(proof, method, targetURL, accessToken string) (string, error) {
+	var jwk JWK
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	token, err := parser.Parse(proof, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != dpopProofType {
+			return nil, errors.New("typ must be " + dpopProofType)
+		}
+		raw, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("missing jwk header")
+		}
+		if _, private := raw["d"]; private {
+			return nil, errors.New("jwk header contains a private key")
+		}
+		encoded, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(encoded, &jwk); err != nil {
+			return nil, err
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		// La clé du client impose l'algorithme ; les secrets symétriques sont exclus par JWK.
+		expected, err := signingMethod(key)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != expected.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", fmt.Errorf("%w: malformed claims", ErrInvalidDPoPProof)
+	}
+
+	if htm, _ := claims["htm"].(string); htm != method {
+		return "", fmt.Errorf("%w: htm does not match the request method", ErrInvalidDPoPProof)
+	}
+	htu, _ := claims["htu"].(string)
+	if normalizeHTU(htu) != normalizeHTU(targetURL) || htu == "" {
+		return "", fmt.Errorf("%w: htu does not match the request URL", ErrInvalidDPoPProof)
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return "", fmt.Errorf("%w: missing iat", ErrInvalidDPoPProof)
+	}
+	issuedAt, now := time.Unix(int64(iat), 0), j.now()
+	if issuedAt.After(now.Add(dpopClockSkew)) || now.Sub(issuedAt) > j.dpopMaxAge {
+		return "", fmt.Errorf("%w: iat is outside the acceptable window", ErrInvalidDPoPProof)
+	}
+	if accessToken != "" {
+		if ath, _ := claims["ath"].(string); ath != accessTokenHash(accessToken) {
+			return "", fmt.Errorf("%w: ath does not match the access token", ErrInvalidDPoPProof)
+		}
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", fmt.Errorf("%w: missing jti", ErrInvalidDPoPProof)
+	}
+	if err := j.dpopReplay.Use(jti, issuedAt.Add(j.dpopMaxAge+dpopClockSkew)); err != nil {
+		if errors.Is(err, ErrReplayDetected) {
+			return "", fmt.Errorf("%w: %w", ErrInvalidDPoPProof, err)
+		}
+		return "", err
+	}
+	return jwk.Thumbprint(), nil
+}
+
+// dpopRequest vérifie l'unique en-tête DPoP d'une requête HTTP et retourne l'empreinte de la clé.
+func (j *Tools) dpopRequest(r *http.Request, accessToken string) (string, error) {
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) != 1 {
+		return "", fmt.Errorf("%w: exactly one DPoP header is required", ErrInvalidDPoPProof)
+	}
+	return j.verifyDPoPProof(proofs[0], r.Method, j.requestURL(r), accessToken)
+}
+
+// requestURL reconstruit l'URL de la requête, sans query ni fragment, à partir de
+// WithDPoPBaseURL ou, à défaut, de l'hôte de la requête.
+func (j *Tools) requestURL(r *http.Request) string {
+	if j.dpopBaseURL != "" {
+		return strings.TrimSuffix(j.dpopBaseURL, "/") + r.URL.Path
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// normalizeHTU retire la query et le fragment d'une URL et met son schéma et son hôte en minuscules
+// (RFC 9449 section 4.3).
+func normalizeHTU(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	u.Scheme, u.Host = strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	u.RawQuery, u.Fragment, u.RawFragment = "", "", ""
+	return u.String()
+}
+
+// confirmationKey retourne l'empreinte cnf.jkt à laquelle le token est lié, ou "".
+func confirmationKey(claims jwt.MapClaims) string {
+	cnf, _ := claims[cnfClaim].(map[string]interface{})
+	jkt, _ := cnf["jkt"].(string)
+	return jkt
+}
+
+// checkBinding vérifie qu'un token lié à une clé (claim cnf.jkt) n'est accepté qu'avec
+// une preuve DPoP de cette clé, et qu'une preuve n'accompagne qu'un token lié à sa clé.
+func checkBinding(claims jwt.MapClaims, cfg *validateConfig) *TokenError {
+	jkt := confirmationKey(claims)
+	switch {
+	case cfg.anyBinding:
+		return nil
+	case cfg.dpopKey == "" && jkt != "":
+		return &TokenError{Reason: ErrTokenBindingMismatch, Claim: cnfClaim, Err: errors.New("the token is bound to a DPoP key")}
+	case cfg.dpopKey != jkt:
+		return &TokenError{Reason: ErrTokenBindingMismatch, Claim: cnfClaim, Err: errors.New("the DPoP proof key does not match the token binding")}
+	}
+	return nil
+}
+
+// accessTokenHash calcule le claim ath d'une preuve DPoP.
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
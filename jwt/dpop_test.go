@@ -0,0 +1,201 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// newDPoPKey génère la clé d'un client DPoP et retourne son empreinte.
+func newDPoPKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	jwk, err := NewJWK("", &key.PublicKey)
+	assert.NoError(t, err)
+	return key, jwk.Thumbprint()
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	key, jkt := newDPoPKey(t)
+	const target = "https://api.example.com/orders"
+
+	proof, err := NewDPoPProof(key, http.MethodGet, target, "access-token")
+	assert.NoError(t, err)
+	got, err := j.VerifyDPoPProof(proof, http.MethodGet, "https://API.example.com/orders?page=2", "access-token")
+	assert.NoError(t, err)
+	assert.Equal(t, jkt, got)
+
+	// Une preuve ne peut servir qu'une fois.
+	_, err = j.VerifyDPoPProof(proof, http.MethodGet, target, "access-token")
+	assert.ErrorIs(t, err, ErrInvalidDPoPProof)
+	assert.ErrorIs(t, err, ErrReplayDetected)
+
+	tests := []struct {
+		name        string
+		method, url string
+		accessToken string
+	}{
+		{"htm", http.MethodPost, target, "access-token"},
+		{"htu", http.MethodGet, "https://api.example.com/payments", "access-token"},
+		{"ath", http.MethodGet, target, "other-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := NewDPoPProof(key, http.MethodGet, target, "access-token")
+			assert.NoError(t, err)
+			_, err = j.VerifyDPoPProof(proof, tt.method, tt.url, tt.accessToken)
+			assert.ErrorIs(t, err, ErrInvalidDPoPProof)
+		})
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		proof, err := NewDPoPProof(key, http.MethodGet, target, "")
+		assert.NoError(t, err)
+		j.now = func() time.Time { return time.Now().Add(10 * time.Minute) }
+		defer func() { j.now = time.Now }()
+		_, err = j.VerifyDPoPProof(proof, http.MethodGet, target, "")
+		assert.ErrorIs(t, err, ErrInvalidDPoPProof)
+	})
+
+	t.Run("not a DPoP proof", func(t *testing.T) {
+		// Un access token ordinaire n'a ni typ dpop+jwt ni jwk.
+		token, err := j.GenerateToken("data")
+		assert.NoError(t, err)
+		_, err = j.VerifyDPoPProof(token, http.MethodGet, target, "")
+		assert.ErrorIs(t, err, ErrInvalidDPoPProof)
+
+		// Une preuve signée par une autre clé que celle de son en-tête jwk est refusée.
+		other, _ := newDPoPKey(t)
+		forged := jwtlib.NewWithClaims(jwtlib.SigningMethodES256, jwtlib.MapClaims{
+			"jti": newID(), "htm": http.MethodGet, "htu": target, "iat": time.Now().Unix(),
+		})
+		jwk, err := NewJWK("", &key.PublicKey)
+		assert.NoError(t, err)
+		forged.Header["typ"] = dpopProofType
+		forged.Header["jwk"] = jwk
+		signed, err := forged.SignedString(other)
+		assert.NoError(t, err)
+		_, err = j.VerifyDPoPProof(signed, http.MethodGet, target, "")
+		assert.ErrorIs(t, err, ErrInvalidDPoPProof)
+	})
+
+	_, err = NewDPoPProof([]byte(strings.Repeat("s", 32)), http.MethodGet, target, "")
+	assert.Error(t, err)
+}
+
+func TestMiddlewareDPoP(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	key, jkt := newDPoPKey(t)
+	bound, err := j.GenerateToken("data", DPoPKey(jkt))
+	assert.NoError(t, err)
+	unbound, err := j.GenerateToken("data")
+	assert.NoError(t, err)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	request := func(scheme, token string, signer *ecdsa.PrivateKey) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://api.example.com/orders?page=1", nil)
+		req.Header.Set("Authorization", scheme+" "+token)
+		if signer != nil {
+			proof, err := NewDPoPProof(signer, http.MethodGet, "http://api.example.com/orders", token)
+			assert.NoError(t, err)
+			req.Header.Set("DPoP", proof)
+		}
+		return req
+	}
+	other, _ := newDPoPKey(t)
+
+	tests := []struct {
+		name      string
+		req       *http.Request
+		opts      []MiddlewareOption
+		status    int
+		challenge string
+	}{
+		{"bound token with proof", request("DPoP", bound, key), nil, http.StatusOK, ""},
+		{"bound token as bearer", request("Bearer", bound, nil), nil, http.StatusUnauthorized, `DPoP error="invalid_token"`},
+		{"missing proof", request("DPoP", bound, nil), nil, http.StatusUnauthorized, `DPoP error="invalid_dpop_proof"`},
+		{"proof from another key", request("DPoP", bound, other), nil, http.StatusUnauthorized, `DPoP error="invalid_token"`},
+		{"unbound token with proof", request("DPoP", unbound, key), nil, http.StatusUnauthorized, `DPoP error="invalid_token"`},
+		{"bearer token", request("Bearer", unbound, nil), nil, http.StatusOK, ""},
+		{"bearer token refused", request("Bearer", unbound, nil), []MiddlewareOption{RequireDPoP()}, http.StatusUnauthorized, `DPoP error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			j.Middleware(tt.opts...)(ok).ServeHTTP(rec, tt.req)
+			assert.Equal(t, tt.status, rec.Code)
+			assert.True(t, strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), tt.challenge))
+		})
+	}
+}
+
+func TestTokenHandlerDPoP(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	j.dpopBaseURL = "https://auth.example.com"
+	handler := j.TokenHandler(newTestClientRegistry(t))
+	key, jkt := newDPoPKey(t)
+
+	post := func(form url.Values, proof string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		withProof := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if proof != "" {
+				r.Header.Set("DPoP", proof)
+			}
+			handler.ServeHTTP(w, r)
+		})
+		return postToken(t, withProof, form, "billing", "s3cret")
+	}
+	proof, err := NewDPoPProof(key, http.MethodPost, "https://auth.example.com/token", "")
+	assert.NoError(t, err)
+
+	rec, body := post(url.Values{"grant_type": {GrantClientCredentials}}, proof)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "DPoP", body["token_type"])
+	// Un token lié n'est validé qu'avec une preuve de sa clé.
+	_, err = j.ValidateToken(body["access_token"].(string))
+	assert.ErrorIs(t, err, ErrTokenBindingMismatch)
+	claims, err := j.ValidateToken(body["access_token"].(string), DPoPProofKey(jkt))
+	assert.NoError(t, err)
+	assert.Equal(t, jkt, confirmationKey(claims))
+
+	// La même preuve ne peut pas être rejouée.
+	rec, body = post(url.Values{"grant_type": {GrantClientCredentials}}, proof)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_dpop_proof", body["error"])
+
+	// Un refresh token lié exige une preuve de la même clé.
+	pair, err := j.IssueTokenPair("data", ClientID("billing"), DPoPKey(jkt))
+	assert.NoError(t, err)
+	refresh := url.Values{"grant_type": {GrantRefreshToken}, "refresh_token": {pair.RefreshToken}}
+	rec, body = post(refresh, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_grant", body["error"])
+	proof, err = NewDPoPProof(key, http.MethodPost, "https://auth.example.com/token", "")
+	assert.NoError(t, err)
+	rec, body = post(refresh, proof)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "DPoP", body["token_type"])
+	claims, err = j.ValidateToken(body["access_token"].(string), DPoPProofKey(jkt))
+	assert.NoError(t, err)
+	assert.Equal(t, jkt, confirmationKey(claims))
+}
+
+func TestMemoryReplayCache(t *testing.T) {
+	cache := NewMemoryReplayCache()
+	assert.NoError(t, cache.Use("a", time.Now().Add(time.Minute)))
+	assert.ErrorIs(t, cache.Use("a", time.Now().Add(time.Minute)), ErrReplayDetected)
+
+	// Un jti expiré est oublié.
+	assert.NoError(t, cache.Use("b", time.Now().Add(-time.Second)))
+	assert.NoError(t, cache.Use("b", time.Now().Add(time.Minute)))
+}
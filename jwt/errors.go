@@ -0,0 +1,167 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Raisons de refus d'un token, utilisables avec errors.Is sur les erreurs de ValidateToken.
+// ErrUnknownKeyID, ErrUnknownIssuer, ErrTokenRevoked, ErrSessionTerminated et ErrSessionIdle complètent cette liste.
+var (
+	// ErrTokenMalformed est la raison d'un token illisible.
+	ErrTokenMalformed = errors.New("token is malformed")
+	// ErrTokenUnverifiable est la raison d'un token dont la clé de vérification est indisponible
+	// (clé non chargée, JWKS injoignable) : le token n'est pas en cause.
+	ErrTokenUnverifiable = errors.New("token is unverifiable")
+	// ErrTokenSignatureInvalid est la raison d'une signature invalide ou d'un algorithme inattendu.
+	ErrTokenSignatureInvalid = errors.New("token signature is invalid")
+	// ErrTokenExpired est la raison d'un token expiré : c'est le seul cas où rafraîchir a un sens.
+	ErrTokenExpired = errors.New("token is expired")
+	// ErrTokenNotValidYet est la raison d'un token dont le claim nbf est dans le futur.
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+	// ErrTokenUsedBeforeIssued est la raison d'un token dont le claim iat est dans le futur.
+	ErrTokenUsedBeforeIssued = errors.New("token used before issued")
+	// ErrTokenInvalidIssuer est la raison d'un token d'un émetteur inattendu.
+	ErrTokenInvalidIssuer = errors.New("token has an unexpected issuer")
+	// ErrTokenInvalidAudience est la raison d'un token destiné à une autre audience.
+	ErrTokenInvalidAudience = errors.New("token has an unexpected audience")
+	// ErrTokenInvalidClaims est la raison d'un token dont un autre claim est invalide.
+	ErrTokenInvalidClaims = errors.New("token has invalid claims")
+	// ErrNotAccessToken est la raison d'un refresh token ou d'un token à usage unique présenté comme access token.
+	ErrNotAccessToken = errors.New("token cannot be used as an access token")
+)
+
+// TokenError décrit le refus d'un token. Elle satisfait errors.Is pour sa raison (ErrTokenExpired, etc.)
+// et, le cas échéant, errors.As pour l'erreur *jwt.ValidationError d'origine.
+type TokenError struct {
+	Reason    error  // raison du refus, une des erreurs sentinelles du package
+	Claim     string // claim en cause (exp, aud, etc.), vide si le refus ne porte pas sur un claim
+	KeyID     string // kid de l'en-tête du token, s'il est lisible
+	Algorithm string // alg de l'en-tête du token (ou version PASETO), s'il est lisible
+	Err       error  // erreur détaillée, facultative
+}
+
+func (e *TokenError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Reason.Error()
+}
+
+func (e *TokenError) Unwrap() []error {
+	errs := []error{e.Reason}
+	if e.Err != nil && e.Err != e.Reason {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// StatusCode retourne le code HTTP correspondant à une erreur de validation, tel que l'applique Middleware :
+// 401 pour un token refusé, 503 quand la vérification n'a pas pu avoir lieu (clés ou stockage indisponibles).
+func StatusCode(err error) int {
+	var tokenErr *TokenError
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrTokenUnverifiable):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &tokenErr):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
+
+// tokenError convertit l'erreur de validation d'un token en *TokenError, complétée du kid et de l'alg du token.
+// Les erreurs qui ne concernent pas le token (stockage indisponible, etc.) sont retournées telles quelles.
+func (j *Tools) tokenError(tokenString string, err error) error {
+	var tokenErr *TokenError
+	if errors.As(err, &tokenErr) {
+		return err
+	}
+	reason, claim := reasonOf(err)
+	if reason == nil {
+		return err
+	}
+	tokenErr = &TokenError{Reason: reason, Claim: claim, Err: err}
+	tokenErr.KeyID, tokenErr.Algorithm = j.tokenHeader(tokenString)
+	return tokenErr
+}
+
+// reasonOf retourne la raison d'une erreur de validation et le claim en cause.
+func reasonOf(err error) (error, string) {
+	switch {
+	case errors.Is(err, ErrUnknownIssuer):
+		return ErrUnknownIssuer, "iss"
+	case errors.Is(err, ErrUnknownKeyID):
+		return ErrUnknownKeyID, ""
+	case errors.Is(err, ErrDecryptionFailed):
+		return ErrTokenSignatureInvalid, ""
+	case errors.Is(err, ErrTokenRevoked):
+		return ErrTokenRevoked, "jti"
+	case errors.Is(err, ErrSessionTerminated):
+		return ErrSessionTerminated, sessionClaim
+	case errors.Is(err, ErrSessionIdle):
+		return ErrSessionIdle, sessionClaim
+	}
+	var validationErr *jwt.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, ""
+	}
+	flags := validationErr.Errors
+	switch {
+	case flags&jwt.ValidationErrorUnverifiable != 0:
+		// Une erreur levée lors du choix de la clé (algorithme inattendu) est plus précise.
+		if validationErr.Inner != nil {
+			if reason, claim := reasonOf(validationErr.Inner); reason != nil {
+				return reason, claim
+			}
+		}
+		return ErrTokenUnverifiable, ""
+	case flags&jwt.ValidationErrorMalformed != 0:
+		return ErrTokenMalformed, ""
+	case flags&jwt.ValidationErrorSignatureInvalid != 0:
+		return ErrTokenSignatureInvalid, ""
+	case flags&jwt.ValidationErrorExpired != 0:
+		return ErrTokenExpired, "exp"
+	case flags&jwt.ValidationErrorNotValidYet != 0:
+		return ErrTokenNotValidYet, "nbf"
+	case flags&jwt.ValidationErrorIssuedAt != 0:
+		return ErrTokenUsedBeforeIssued, "iat"
+	case flags&jwt.ValidationErrorIssuer != 0:
+		return ErrTokenInvalidIssuer, "iss"
+	case flags&jwt.ValidationErrorAudience != 0:
+		return ErrTokenInvalidAudience, "aud"
+	default:
+		return ErrTokenInvalidClaims, ""
+	}
+}
+
+// tokenHeader lit, sans les vérifier, le kid et l'algorithme d'un token.
+func (j *Tools) tokenHeader(tokenString string) (kid, alg string) {
+	if j.format != FormatJWT {
+		_, rest, _ := strings.Cut(tokenString, j.format.String()+".")
+		if _, _, kid, err := splitPASETO(rest); err == nil {
+			return kid, j.format.String()
+		}
+		return "", j.format.String()
+	}
+	encoded, _, _ := strings.Cut(tokenString, ".")
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ""
+	}
+	var header struct {
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return "", ""
+	}
+	return header.Kid, header.Alg
+}
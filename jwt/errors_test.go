@@ -0,0 +1,133 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenErrors(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	WithRevocationStore(NewMemoryRevocationStore())(j)
+	kid := legacyKeyID(j.publicKey)
+	token, err := j.GenerateToken("data", Subject("user-1"), Audience("api"))
+	assert.NoError(t, err)
+	pair, err := j.IssueTokenPair("data", Subject("user-1"))
+	assert.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	forged, err := jwtlib.NewWithClaims(jwtlib.SigningMethodRS256, jwtlib.MapClaims{"sub": "user-1"}).SignedString(otherKey)
+	assert.NoError(t, err)
+	none, err := jwtlib.NewWithClaims(jwtlib.SigningMethodNone, jwtlib.MapClaims{"sub": "user-1"}).SignedString(jwtlib.UnsafeAllowNoneSignatureType)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		token  string
+		opts   []ValidateOption
+		clock  time.Duration
+		reason error
+		claim  string
+		kid    string
+		alg    string
+	}{
+		{"malformed", "not-a-token", nil, 0, ErrTokenMalformed, "", "", ""},
+		{"expired", token, nil, 2 * time.Hour, ErrTokenExpired, "exp", kid, "RS256"},
+		{"not yet valid", token, nil, -time.Hour, ErrTokenUsedBeforeIssued, "iat", kid, "RS256"},
+		{"audience", token, []ValidateOption{ExpectAudiences("admin")}, 0, ErrTokenInvalidAudience, "aud", kid, "RS256"},
+		{"issuer", token, []ValidateOption{ExpectIssuers("auth")}, 0, ErrTokenInvalidIssuer, "iss", kid, "RS256"},
+		{"signature", forged, nil, 0, ErrTokenSignatureInvalid, "", "", "RS256"},
+		{"algorithm", none, nil, 0, ErrTokenSignatureInvalid, "", "", "none"},
+		{"refresh token", pair.RefreshToken, nil, 0, ErrNotAccessToken, tokenUseClaim, kid, "RS256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j.now = func() time.Time { return time.Now().Add(tt.clock) }
+			_, err := j.ValidateToken(tt.token, tt.opts...)
+			assert.ErrorIs(t, err, tt.reason)
+			var tokenErr *TokenError
+			if assert.ErrorAs(t, err, &tokenErr) {
+				assert.Equal(t, tt.reason, tokenErr.Reason)
+				assert.Equal(t, tt.claim, tokenErr.Claim)
+				assert.Equal(t, tt.kid, tokenErr.KeyID)
+				assert.Equal(t, tt.alg, tokenErr.Algorithm)
+			}
+			assert.Equal(t, http.StatusUnauthorized, StatusCode(err))
+		})
+	}
+
+	// L'erreur d'origine reste accessible.
+	j.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = j.ValidateToken(token)
+	assert.ErrorIs(t, err, jwtlib.ErrTokenExpired)
+	var validationErr *jwtlib.ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "Token is expired", err.Error())
+
+	j.now = time.Now
+	assert.NoError(t, j.RevokeToken(token))
+	_, err = j.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	var tokenErr *TokenError
+	if assert.ErrorAs(t, err, &tokenErr) {
+		assert.Equal(t, "jti", tokenErr.Claim)
+	}
+}
+
+func TestTokenErrorsPASETO(t *testing.T) {
+	previous := New(time.Hour, WithFormat(FormatPASETOLocal), WithPASETOLocalKey("k1", newPASETOLocalKey(t)))
+	previous.OnError(func(error) {})
+	j := New(time.Hour, WithFormat(FormatPASETOLocal), WithPASETOLocalKey("k2", newPASETOLocalKey(t)))
+	j.OnError(func(error) {})
+	token, err := previous.GenerateToken("data")
+	assert.NoError(t, err)
+
+	_, err = j.ValidateToken(token)
+	var tokenErr *TokenError
+	if assert.ErrorAs(t, err, &tokenErr) {
+		assert.Equal(t, ErrUnknownKeyID, tokenErr.Reason)
+		assert.Equal(t, "k1", tokenErr.KeyID)
+		assert.Equal(t, "v4.local", tokenErr.Algorithm)
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	assert.Equal(t, http.StatusOK, StatusCode(nil))
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(&TokenError{Reason: ErrTokenExpired}))
+	assert.Equal(t, http.StatusServiceUnavailable, StatusCode(&TokenError{Reason: ErrTokenUnverifiable}))
+	assert.Equal(t, http.StatusServiceUnavailable, StatusCode(errors.New("database is down")))
+}
+
+func TestMiddlewareStatusCodes(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	token, err := j.GenerateToken("data")
+	assert.NoError(t, err)
+	handler := j.Middleware()(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	j.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	rec := serve()
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), `Bearer error="invalid_token"`))
+
+	// Sans clé de vérification, le token n'est pas en cause : pas de challenge.
+	j.now = time.Now
+	j.publicKey = nil
+	rec = serve()
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+}
@@ -0,0 +1,201 @@
+// Package grpcauth authentifie les appels gRPC avec les tokens du package jwt :
+// intercepteurs serveur (unaire et streaming) et identifiants côté client.
+package grpcauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/abdotop/tools/jwt"
+)
+
+// authorizationKey est la clé de métadonnées portant le token (en minuscules, comme l'exige gRPC).
+const authorizationKey = "authorization"
+
+// Validator valide un token et retourne ses claims. L'instance retournée par jwt.New le satisfait.
+// Si le Validator fournit aussi CheckToken, comme *jwt.Tools, les intercepteurs l'utilisent :
+// les tokens invalides envoyés par les clients ne sont pas publiés sur le callback d'OnError.
+type Validator interface {
+	ValidateToken(tokenString string, opts ...jwt.ValidateOption) (jwtlib.MapClaims, error)
+}
+
+// checker est implémenté par *jwt.Tools (voir jwt.Tools.CheckToken).
+type checker interface {
+	CheckToken(tokenString string, opts ...jwt.ValidateOption) (jwtlib.MapClaims, error)
+}
+
+// Generator génère un token. L'instance retournée par jwt.New le satisfait.
+type Generator interface {
+	GenerateToken(data interface{}, opts ...jwt.TokenOption) (string, error)
+}
+
+// ServerOption configure les intercepteurs serveur.
+type ServerOption func(*serverConfig)
+
+// serverConfig regroupe les paramètres des intercepteurs serveur.
+type serverConfig struct {
+	validateOpts []jwt.ValidateOption
+	skipped      map[string]bool
+}
+
+// ValidateWith applique des options de validation à chaque appel.
+func ValidateWith(opts ...jwt.ValidateOption) ServerOption {
+	return func(c *serverConfig) {
+		c.validateOpts = opts
+	}
+}
+
+// SkipMethods exempte d'authentification les méthodes données,
+// sous leur nom complet (par exemple "/grpc.health.v1.Health/Check").
+func SkipMethods(methods ...string) ServerOption {
+	return func(c *serverConfig) {
+		for _, method := range methods {
+			c.skipped[method] = true
+		}
+	}
+}
+
+func newServerConfig(opts []ServerOption) *serverConfig {
+	cfg := &serverConfig{skipped: make(map[string]bool)}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// UnaryServerInterceptor authentifie les appels unaires : le token est lu dans la métadonnée
+// authorization (schéma Bearer) puis validé ; ses claims sont placés dans le contexte et se lisent
+// avec jwt.ClaimsFromContext. Sinon l'appel est refusé avec le code Unauthenticated, ou Unavailable
+// quand la vérification n'a pas pu avoir lieu (JWKS ou stockage indisponibles), comme jwt.StatusCode.
+func UnaryServerInterceptor(v Validator, opts ...ServerOption) grpc.UnaryServerInterceptor {
+	cfg := newServerConfig(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if cfg.skipped[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		ctx, err := cfg.authenticate(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authentifie les appels en streaming comme UnaryServerInterceptor.
+func StreamServerInterceptor(v Validator, opts ...ServerOption) grpc.StreamServerInterceptor {
+	cfg := newServerConfig(opts)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if cfg.skipped[info.FullMethod] {
+			return handler(srv, stream)
+		}
+		ctx, err := cfg.authenticate(stream.Context(), v)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authenticate valide le token des métadonnées entrantes et retourne le contexte enrichi des claims.
+func (c *serverConfig) authenticate(ctx context.Context, v Validator) (context.Context, error) {
+	tokenString, err := tokenFromMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	validate := v.ValidateToken
+	if quiet, ok := v.(checker); ok {
+		validate = quiet.CheckToken
+	}
+	claims, err := validate(tokenString, c.validateOpts...)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return jwt.ContextWithClaims(ctx, claims), nil
+}
+
+// statusError convertit une erreur de validation en statut gRPC selon jwt.StatusCode :
+// Unauthenticated pour un token refusé, Unavailable quand la vérification n'a pas pu avoir lieu.
+func statusError(err error) error {
+	if jwt.StatusCode(err) == http.StatusUnauthorized {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// tokenFromMetadata lit le token Bearer des métadonnées entrantes. Une seule valeur est acceptée.
+func tokenFromMetadata(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(authorizationKey)
+	switch len(values) {
+	case 0:
+		return "", status.Error(codes.Unauthenticated, "missing bearer token")
+	case 1:
+	default:
+		return "", status.Error(codes.Unauthenticated, "more than one authorization value")
+	}
+	scheme, credentials, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(credentials) == "" {
+		return "", status.Error(codes.Unauthenticated, "malformed authorization value")
+	}
+	return strings.TrimSpace(credentials), nil
+}
+
+// serverStream remplace le contexte d'un flux serveur par le contexte authentifié.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// CredentialsOption configure les identifiants côté client.
+type CredentialsOption func(*tokenCredentials)
+
+// AllowInsecure autorise l'envoi du token sur une connexion non chiffrée (tests, réseau local).
+func AllowInsecure() CredentialsOption {
+	return func(c *tokenCredentials) {
+		c.insecure = true
+	}
+}
+
+// tokenCredentials attache un token fraîchement généré à chaque appel.
+type tokenCredentials struct {
+	generator Generator
+	data      interface{}
+	tokenOpts []jwt.TokenOption
+	insecure  bool
+}
+
+// NewCredentials retourne des identifiants par appel qui génèrent un token avec
+// GenerateToken(data, tokenOpts...) et l'envoient dans la métadonnée authorization.
+// Ils s'utilisent avec grpc.WithPerRPCCredentials. Par défaut, une connexion TLS est exigée.
+func NewCredentials(generator Generator, data interface{}, tokenOpts []jwt.TokenOption, opts ...CredentialsOption) credentials.PerRPCCredentials {
+	c := &tokenCredentials{generator: generator, data: data, tokenOpts: tokenOpts}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	tokenString, err := c.generator.GenerateToken(c.data, c.tokenOpts...)
+	if err != nil {
+		// L'appelant n'a pas pu produire son token : ce n'est pas un refus du serveur.
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return map[string]string{authorizationKey: "Bearer " + tokenString}, nil
+}
+
+func (c *tokenCredentials) RequireTransportSecurity() bool {
+	return !c.insecure
+}
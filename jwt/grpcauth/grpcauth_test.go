@@ -0,0 +1,210 @@
+package grpcauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/abdotop/tools/jwt"
+)
+
+// healthServer indique dans ses réponses si les claims sont présents dans le contexte.
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+}
+
+func (healthServer) Check(ctx context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if _, ok := jwt.ClaimsFromContext(ctx); !ok {
+		return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_UNKNOWN}, nil
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func (healthServer) Watch(_ *grpc_health_v1.HealthCheckRequest, stream grpc_health_v1.Health_WatchServer) error {
+	claims, ok := jwt.ClaimsFromContext(stream.Context())
+	if !ok || claims["sub"] != "svc-a" {
+		return status.Error(codes.Internal, "claims missing from stream context")
+	}
+	return stream.Send(&grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING})
+}
+
+func newTestTools(t *testing.T) interface {
+	Validator
+	Generator
+} {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	keyRing, err := jwt.NewKeyRing(jwt.Key{ID: "k1", PrivateKey: privateKey})
+	assert.NoError(t, err)
+	j := jwt.New(time.Hour, jwt.WithKeyRing(keyRing))
+	j.OnError(func(error) {})
+	return j
+}
+
+// startServer démarre un serveur gRPC en mémoire et retourne une fonction de connexion.
+func startServer(t *testing.T, v Validator, opts ...ServerOption) func(...grpc.DialOption) grpc_health_v1.HealthClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(v, opts...)),
+		grpc.StreamInterceptor(StreamServerInterceptor(v, opts...)),
+	)
+	grpc_health_v1.RegisterHealthServer(server, healthServer{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return func(dialOpts ...grpc.DialOption) grpc_health_v1.HealthClient {
+		dialOpts = append(dialOpts,
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		conn, err := grpc.NewClient("passthrough:///bufnet", dialOpts...)
+		assert.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return grpc_health_v1.NewHealthClient(conn)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	j := newTestTools(t)
+	dial := startServer(t, j)
+	ctx := context.Background()
+
+	client := dial(grpc.WithPerRPCCredentials(NewCredentials(j, nil, []jwt.TokenOption{jwt.Subject("svc-a")}, AllowInsecure())))
+	resp, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+
+	anonymous := dial()
+	_, err = anonymous.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	for _, value := range []string{"Bearer not-a-token", "Basic dXNlcjpwYXNz", "Bearer"} {
+		md := metadata.Pairs("authorization", value)
+		_, err = anonymous.Check(metadata.NewOutgoingContext(ctx, md), &grpc_health_v1.HealthCheckRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), value)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	j := newTestTools(t)
+	dial := startServer(t, j)
+	ctx := context.Background()
+
+	client := dial(grpc.WithPerRPCCredentials(NewCredentials(j, nil, []jwt.TokenOption{jwt.Subject("svc-a")}, AllowInsecure())))
+	stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(t, err)
+	resp, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+
+	stream, err = dial().Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServerInterceptorOptions(t *testing.T) {
+	j := newTestTools(t)
+	dial := startServer(t, j,
+		ValidateWith(jwt.ExpectAudiences("orders")),
+		SkipMethods("/grpc.health.v1.Health/Check"),
+	)
+	ctx := context.Background()
+
+	// Méthode exemptée : l'appel passe sans token et sans claims.
+	resp, err := dial().Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_UNKNOWN, resp.Status)
+
+	wrongAudience := dial(grpc.WithPerRPCCredentials(NewCredentials(j, nil,
+		[]jwt.TokenOption{jwt.Subject("svc-a"), jwt.Audience("billing")}, AllowInsecure())))
+	stream, err := wrongAudience.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestCredentialsRequireTransportSecurity(t *testing.T) {
+	j := newTestTools(t)
+	assert.True(t, NewCredentials(j, nil, nil).RequireTransportSecurity())
+	assert.False(t, NewCredentials(j, nil, nil, AllowInsecure()).RequireTransportSecurity())
+
+	md, err := NewCredentials(j, map[string]string{"role": "worker"}, nil).GetRequestMetadata(context.Background())
+	assert.NoError(t, err)
+	tokenString := md["authorization"][len("Bearer "):]
+	claims, err := j.ValidateToken(tokenString)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"role": "worker"}, claims["data"])
+}
+
+func TestServerInterceptorWithoutOnError(t *testing.T) {
+	// Sans callback OnError, un token invalide ne doit pas bloquer l'appel.
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	keyRing, err := jwt.NewKeyRing(jwt.Key{ID: "k1", PrivateKey: privateKey})
+	assert.NoError(t, err)
+	j := jwt.New(time.Hour, jwt.WithKeyRing(keyRing))
+	dial := startServer(t, j)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	md := metadata.Pairs("authorization", "Bearer not-a-token")
+	_, err = dial().Check(metadata.NewOutgoingContext(ctx, md), &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServerInterceptorRejectsDPoPBoundTokens(t *testing.T) {
+	// Un token lié à une clé DPoP ne vaut rien sans preuve : gRPC ne transporte pas de preuve.
+	j := newTestTools(t)
+	dial := startServer(t, j)
+	client := dial(grpc.WithPerRPCCredentials(NewCredentials(j, nil,
+		[]jwt.TokenOption{jwt.Subject("svc-a"), jwt.DPoPKey("0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I")}, AllowInsecure())))
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// failingRevocationStore simule un stockage de révocation indisponible.
+type failingRevocationStore struct {
+	jwt.RevocationStore
+}
+
+func (failingRevocationStore) IsRevoked(string) (bool, error) {
+	return false, errors.New("revocation store unavailable")
+}
+
+func TestServerInterceptorStoreOutage(t *testing.T) {
+	// Une panne du stockage n'invite pas le client à se réauthentifier.
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	keyRing, err := jwt.NewKeyRing(jwt.Key{ID: "k1", PrivateKey: privateKey})
+	assert.NoError(t, err)
+	j := jwt.New(time.Hour, jwt.WithKeyRing(keyRing), jwt.WithRevocationStore(failingRevocationStore{jwt.NewMemoryRevocationStore()}))
+	j.OnError(func(error) {})
+	dial := startServer(t, j)
+
+	client := dial(grpc.WithPerRPCCredentials(NewCredentials(j, nil, []jwt.TokenOption{jwt.Subject("svc-a")}, AllowInsecure())))
+	_, err = client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	stream, err := client.Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
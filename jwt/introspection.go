@@ -0,0 +1,147 @@
+package jwt
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// introspectionResponse est la réponse du endpoint d'introspection (RFC 7662, section 2.2).
+// Un token inactif n'expose que le champ active.
+type introspectionResponse struct {
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	Exp       int64       `json:"exp,omitempty"`
+	Iat       int64       `json:"iat,omitempty"`
+	Nbf       int64       `json:"nbf,omitempty"`
+	Sub       string      `json:"sub,omitempty"`
+	Aud       interface{} `json:"aud,omitempty"`
+	Iss       string      `json:"iss,omitempty"`
+	Jti       string      `json:"jti,omitempty"`
+	Cnf       interface{} `json:"cnf,omitempty"`
+}
+
+// IntrospectionHandler retourne le endpoint d'introspection de la RFC 7662. Le client doit
+// s'authentifier comme au endpoint de token ; la réponse indique si le token est actif,
+// c'est-à-dire accepté par ValidateToken. Les refresh tokens ne sont jamais actifs.
+// Les clients publics, qui ne s'authentifient pas, ne peuvent pas introspecter.
+func (j *Tools) IntrospectionHandler(clients ClientRegistry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, client, oerr := tokenEndpointRequest(r, clients)
+		if oerr == nil && client.Public {
+			oerr = invalidClientError(false)
+		}
+		if oerr != nil {
+			writeOAuthError(w, oerr)
+			return
+		}
+		// Le serveur de ressources vérifie lui-même la preuve DPoP d'après le champ cnf.
+		cfg := j.newValidateConfig(nil)
+		cfg.anyBinding = true
+		claims, err := j.validate(tokenString, cfg)
+		if err != nil {
+			writeOAuthJSON(w, http.StatusOK, &introspectionResponse{Active: false})
+			return
+		}
+		resp := &introspectionResponse{
+			Active:    true,
+			Scope:     stringClaim(claims, scopeClaim),
+			ClientID:  stringClaim(claims, clientIDClaim),
+			TokenType: tokenType(confirmationKey(claims)),
+			Exp:       int64Claim(claims, "exp"),
+			Iat:       int64Claim(claims, "iat"),
+			Nbf:       int64Claim(claims, "nbf"),
+			Sub:       stringClaim(claims, "sub"),
+			Aud:       claims["aud"],
+			Iss:       stringClaim(claims, "iss"),
+			Jti:       stringClaim(claims, "jti"),
+			Cnf:       claims[cnfClaim],
+		}
+		writeOAuthJSON(w, http.StatusOK, resp)
+	})
+}
+
+// RevocationHandler retourne le endpoint de révocation de la RFC 7009. Un client ne peut
+// révoquer que les tokens émis pour lui (claim client_id). Révoquer un refresh token invalide
+// toute sa famille ; révoquer un access token nécessite un RevocationStore.
+// Un token invalide ou expiré est ignoré et la réponse est 200, comme le prévoit la RFC.
+func (j *Tools) RevocationHandler(clients ClientRegistry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, client, oerr := tokenEndpointRequest(r, clients)
+		if oerr != nil {
+			writeOAuthError(w, oerr)
+			return
+		}
+		if oerr := j.revokeForClient(tokenString, client); oerr != nil {
+			writeOAuthError(w, oerr)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (j *Tools) revokeForClient(tokenString string, client *Client) *oauthError {
+	claims, err := j.parse(tokenString, j.newValidateConfig(nil))
+	if err != nil {
+		var tokenErr *TokenError
+		if errors.As(err, &tokenErr) {
+			return nil
+		}
+		return newOAuthError(http.StatusServiceUnavailable, "server_error", "")
+	}
+	if claims[clientIDClaim] != client.ID {
+		return newOAuthError(http.StatusBadRequest, "unauthorized_client", "the token was issued to another client")
+	}
+
+	if claims[tokenUseClaim] == tokenUseRefresh {
+		family, _ := claims[familyClaim].(string)
+		if family == "" {
+			return nil
+		}
+		if err := j.refreshStore.RevokeFamily(family); err != nil {
+			return newOAuthError(http.StatusServiceUnavailable, "server_error", "")
+		}
+		return nil
+	}
+	if err := j.revokeToken(tokenString); err != nil {
+		if errors.Is(err, ErrNoRevocationStore) {
+			return newOAuthError(http.StatusBadRequest, "unsupported_token_type", "access tokens cannot be revoked")
+		}
+		return newOAuthError(http.StatusServiceUnavailable, "server_error", "")
+	}
+	return nil
+}
+
+// tokenEndpointRequest vérifie une requête d'introspection ou de révocation :
+// méthode POST, client authentifié et paramètre token présent.
+func tokenEndpointRequest(r *http.Request, clients ClientRegistry) (string, *Client, *oauthError) {
+	if r.Method != http.MethodPost {
+		return "", nil, newOAuthError(http.StatusMethodNotAllowed, "invalid_request", "only POST is accepted")
+	}
+	if err := r.ParseForm(); err != nil {
+		return "", nil, newOAuthError(http.StatusBadRequest, "invalid_request", "malformed form body")
+	}
+	client, oerr := authenticateClient(r, clients)
+	if oerr != nil {
+		return "", nil, oerr
+	}
+	tokenString := r.PostForm.Get("token")
+	if tokenString == "" {
+		return "", nil, newOAuthError(http.StatusBadRequest, "invalid_request", "missing token")
+	}
+	return tokenString, client, nil
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func int64Claim(claims jwt.MapClaims, name string) int64 {
+	value, _ := claims[name].(float64)
+	return int64(value)
+}
@@ -0,0 +1,117 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntrospectionHandler(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	handler := j.IntrospectionHandler(newTestClientRegistry(t))
+	token, err := j.GenerateToken("data", Subject("user-1"), ClientID("billing"), Scopes("orders:read"), Audience("api"))
+	assert.NoError(t, err)
+
+	rec, body := postToken(t, handler, url.Values{"token": {token}}, "reporting", "r3port")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, true, body["active"])
+	assert.Equal(t, "orders:read", body["scope"])
+	assert.Equal(t, "billing", body["client_id"])
+	assert.Equal(t, "user-1", body["sub"])
+	assert.Equal(t, "api", body["aud"])
+	assert.Equal(t, "Bearer", body["token_type"])
+	assert.NotZero(t, body["exp"])
+
+	// Un token invalide ou un refresh token ne sont pas actifs et rien d'autre n'est divulgué.
+	pair, err := j.IssueTokenPair("data", ClientID("billing"))
+	assert.NoError(t, err)
+	for _, inactive := range []string{"garbage", pair.RefreshToken} {
+		rec, body = postToken(t, handler, url.Values{"token": {inactive}}, "billing", "s3cret")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, map[string]interface{}{"active": false}, body)
+	}
+
+	rec, body = postToken(t, handler, url.Values{"token": {token}}, "billing", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_client", body["error"])
+	rec, body = postToken(t, handler, url.Values{}, "billing", "s3cret")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_request", body["error"])
+
+	// Un client public ne peut pas introspecter.
+	clients := newTestClientRegistry(t)
+	assert.NoError(t, clients.Register(Client{ID: "spa", Public: true}, ""))
+	rec, body = postToken(t, j.IntrospectionHandler(clients), url.Values{"token": {token}, "client_id": {"spa"}}, "", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_client", body["error"])
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/introspect", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+}
+
+// postRevocation envoie une requête au endpoint de révocation et retourne le code HTTP.
+func postRevocation(t *testing.T, handler http.Handler, token, user, password string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/revoke", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(user, password)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestRevocationHandler(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	j.revocationStore = NewMemoryRevocationStore()
+	clients := newTestClientRegistry(t)
+	handler := j.RevocationHandler(clients)
+	introspect := j.IntrospectionHandler(clients)
+
+	token, err := j.GenerateToken("data", ClientID("billing"))
+	assert.NoError(t, err)
+
+	// Seul le client pour lequel le token a été émis peut le révoquer.
+	assert.Equal(t, http.StatusBadRequest, postRevocation(t, handler, token, "reporting", "r3port"))
+	assert.Equal(t, http.StatusUnauthorized, postRevocation(t, handler, token, "billing", "wrong"))
+	_, err = j.ValidateToken(token)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, postRevocation(t, handler, token, "billing", "s3cret"))
+	_, err = j.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, body := postToken(t, introspect, url.Values{"token": {token}}, "billing", "s3cret")
+	assert.Equal(t, false, body["active"])
+
+	// Révoquer à nouveau, ou révoquer un token invalide, n'est pas une erreur.
+	assert.Equal(t, http.StatusOK, postRevocation(t, handler, token, "billing", "s3cret"))
+	assert.Equal(t, http.StatusOK, postRevocation(t, handler, "garbage", "billing", "s3cret"))
+
+	// Révoquer un refresh token invalide toute sa famille.
+	pair, err := j.IssueTokenPair("data", ClientID("billing"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, postRevocation(t, handler, pair.RefreshToken, "billing", "s3cret"))
+	_, err = j.RefreshTokenPair(pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenRevoked)
+}
+
+func TestRevocationHandlerWithoutStore(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	handler := j.RevocationHandler(newTestClientRegistry(t))
+	token, err := j.GenerateToken("data", ClientID("billing"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, postRevocation(t, handler, token, "billing", "s3cret"))
+
+	// Les refresh tokens restent révocables grâce au RefreshStore.
+	pair, err := j.IssueTokenPair("data", ClientID("billing"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, postRevocation(t, handler, pair.RefreshToken, "billing", "s3cret"))
+}
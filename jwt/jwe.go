@@ -0,0 +1,317 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	jweAlgRSAOAEP    = "RSA-OAEP"
+	jweAlgRSAOAEP256 = "RSA-OAEP-256"
+	jweAlgECDHES     = "ECDH-ES"
+	jweEncA256GCM    = "A256GCM"
+	jweContentType   = "JWT"
+
+	jweKeySize = 32
+	jweIVSize  = 12
+	jweTagSize = 16
+)
+
+// ErrDecryptionFailed est retournée quand un token chiffré ne peut pas être déchiffré
+// avec la clé de l'instance. La cause exacte n'est volontairement pas précisée ;
+// le refus est une *TokenError de raison ErrTokenSignatureInvalid.
+var ErrDecryptionFailed = errors.New("token decryption failed")
+
+// jweHeader est l'en-tête protégé d'un token chiffré (RFC 7516).
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Cty string `json:"cty,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Epk *JWK   `json:"epk,omitempty"`
+	Apu string `json:"apu,omitempty"`
+	Apv string `json:"apv,omitempty"`
+}
+
+// GenerateEncryptedToken génère un token signé comme GenerateToken puis le chiffre (JWE imbriqué,
+// sign-then-encrypt) : le contenu n'est lisible que par le détenteur de la clé privée.
+// La clé de contenu est protégée par RSA-OAEP-256 pour une clé RSA ou par ECDH-ES pour une clé ECDSA,
+// et le token signé est chiffré en A256GCM.
+// Comme GenerateToken, une erreur est aussi publiée sur le callback d'OnError : sans callback
+// enregistré, l'appel reste bloqué.
+func (j *Tools) GenerateEncryptedToken(data interface{}, opts ...TokenOption) (string, error) {
+	tokenString, _, err := j.generate(data, j.newTokenConfig(opts))
+	if err != nil {
+		j.errChan <- err
+		return "", err
+	}
+	encrypted, err := j.encrypt([]byte(tokenString))
+	if err != nil {
+		j.errChan <- err
+		return "", err
+	}
+	return encrypted, nil
+}
+
+// ValidateEncryptedToken déchiffre un token produit par GenerateEncryptedToken
+// puis valide le token signé qu'il contient comme ValidateToken.
+// Un token qui ne peut pas être déchiffré est refusé comme un token mal signé (*TokenError,
+// StatusCode 401). En revanche, une clé de déchiffrement absente ou d'un type non pris en charge
+// est une erreur de configuration du serveur : elle n'est pas une *TokenError et StatusCode
+// retourne 503.
+// Comme ValidateToken, une erreur est aussi publiée sur le callback d'OnError : sans callback
+// enregistré, l'appel reste bloqué.
+func (j *Tools) ValidateEncryptedToken(tokenString string, opts ...ValidateOption) (jwt.MapClaims, error) {
+	payload, err := j.decrypt(tokenString)
+	if err != nil {
+		err = j.tokenError(tokenString, err)
+		j.errChan <- err
+		return nil, err
+	}
+	claims, err := j.validate(string(payload), j.newValidateConfig(opts))
+	if err != nil {
+		j.errChan <- err
+		return nil, err
+	}
+	return claims, nil
+}
+
+// encryptionKey retourne la clé publique du destinataire des tokens chiffrés :
+// celle de WithEncryptionKeys, sinon la clé chargée par les méthodes Load*.
+func (j *Tools) encryptionKey() (crypto.PublicKey, error) {
+	if j.encryptTo != nil {
+		return j.encryptTo, nil
+	}
+	privateKey, publicKey := j.loadedKeys()
+	if publicKey != nil {
+		return publicKey, nil
+	}
+	if privateKey != nil {
+		return publicKeyOf(privateKey)
+	}
+	return nil, errors.New("encryption key not loaded")
+}
+
+// decryptionKey retourne la clé privée servant à déchiffrer les tokens :
+// celle de WithEncryptionKeys, sinon la clé chargée par les méthodes Load*.
+func (j *Tools) decryptionKey() (crypto.PrivateKey, error) {
+	if j.decryptWith != nil {
+		return j.decryptWith, nil
+	}
+	if privateKey, _ := j.loadedKeys(); privateKey != nil {
+		return privateKey, nil
+	}
+	return nil, errors.New("decryption key not loaded")
+}
+
+// encrypt chiffre un token signé en JWE compact.
+func (j *Tools) encrypt(payload []byte) (string, error) {
+	key, err := j.encryptionKey()
+	if err != nil {
+		return "", err
+	}
+	header := jweHeader{Enc: jweEncA256GCM, Cty: jweContentType, Kid: legacyKeyID(key)}
+	var cek, encryptedKey []byte
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		header.Alg = jweAlgRSAOAEP256
+		cek = make([]byte, jweKeySize)
+		if _, err := rand.Read(cek); err != nil {
+			return "", err
+		}
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, k, cek, nil)
+		if err != nil {
+			return "", err
+		}
+	case *ecdsa.PublicKey:
+		// ECDH-ES en accord direct : la clé de contenu est dérivée du secret partagé
+		// avec une clé éphémère publiée dans l'en-tête (RFC 7518, section 4.6).
+		header.Alg = jweAlgECDHES
+		ephemeral, err := ecdsa.GenerateKey(k.Curve, rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		epk, err := NewJWK("", &ephemeral.PublicKey)
+		if err != nil {
+			return "", err
+		}
+		epk.Use, epk.Alg = "", ""
+		header.Epk = &epk
+		z, err := ecdhSharedSecret(ephemeral, k)
+		if err != nil {
+			return "", err
+		}
+		cek = concatKDF(z, jweEncA256GCM, nil, nil, jweKeySize)
+	default:
+		return "", fmt.Errorf("key type %T cannot be used for encryption", key)
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(headerJSON)
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, jweIVSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	// L'en-tête protégé encodé sert de données authentifiées (RFC 7516, section 5.1).
+	sealed := gcm.Seal(nil, iv, payload, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-jweTagSize], sealed[len(sealed)-jweTagSize:]
+	return strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// decrypt déchiffre un JWE compact et retourne le token signé qu'il contient.
+// L'algorithme de protection de la clé est imposé par le type de la clé de l'instance.
+func (j *Tools) decrypt(tokenString string) ([]byte, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 5 {
+		return nil, jwt.NewValidationError("token is not an encrypted token", jwt.ValidationErrorMalformed)
+	}
+	decoded := make([][]byte, 5)
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return nil, jwt.NewValidationError("malformed encrypted token", jwt.ValidationErrorMalformed)
+		}
+	}
+	var header jweHeader
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		return nil, jwt.NewValidationError("malformed encrypted token header", jwt.ValidationErrorMalformed)
+	}
+	if header.Enc != jweEncA256GCM {
+		return nil, jwt.NewValidationError("unsupported content encryption "+header.Enc, jwt.ValidationErrorMalformed)
+	}
+	if !strings.EqualFold(header.Cty, jweContentType) {
+		return nil, jwt.NewValidationError("encrypted token does not contain a signed token", jwt.ValidationErrorMalformed)
+	}
+
+	key, err := j.decryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	var cek []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var h hash.Hash
+		switch header.Alg {
+		case jweAlgRSAOAEP256:
+			h = sha256.New()
+		case jweAlgRSAOAEP:
+			h = sha1.New()
+		default:
+			return nil, jwt.NewValidationError("unexpected key management algorithm", jwt.ValidationErrorSignatureInvalid)
+		}
+		cek, err = rsa.DecryptOAEP(h, nil, k, decoded[1], nil)
+		if err != nil {
+			return nil, ErrDecryptionFailed
+		}
+	case *ecdsa.PrivateKey:
+		if header.Alg != jweAlgECDHES || header.Epk == nil || len(decoded[1]) != 0 {
+			return nil, jwt.NewValidationError("unexpected key management algorithm", jwt.ValidationErrorSignatureInvalid)
+		}
+		epk, err := header.Epk.PublicKey()
+		if err != nil {
+			return nil, ErrDecryptionFailed
+		}
+		ephemeral, ok := epk.(*ecdsa.PublicKey)
+		if !ok || ephemeral.Curve != k.Curve {
+			return nil, ErrDecryptionFailed
+		}
+		apu, err := base64.RawURLEncoding.DecodeString(header.Apu)
+		if err != nil {
+			return nil, ErrDecryptionFailed
+		}
+		apv, err := base64.RawURLEncoding.DecodeString(header.Apv)
+		if err != nil {
+			return nil, ErrDecryptionFailed
+		}
+		z, err := ecdhSharedSecret(k, ephemeral)
+		if err != nil {
+			return nil, ErrDecryptionFailed
+		}
+		cek = concatKDF(z, jweEncA256GCM, apu, apv, jweKeySize)
+	default:
+		return nil, fmt.Errorf("key type %T cannot be used for decryption", key)
+	}
+
+	if len(cek) != jweKeySize || len(decoded[2]) != jweIVSize || len(decoded[4]) != jweTagSize {
+		return nil, ErrDecryptionFailed
+	}
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	payload, err := gcm.Open(nil, decoded[2], append(decoded[3], decoded[4]...), []byte(parts[0]))
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return payload, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ecdhSharedSecret calcule le secret partagé Z entre une clé privée et une clé publique de même courbe.
+func ecdhSharedSecret(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey) ([]byte, error) {
+	private, err := privateKey.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	public, err := publicKey.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	return private.ECDH(public)
+}
+
+// concatKDF dérive une clé de size octets avec le Concat KDF SHA-256 (NIST SP 800-56A)
+// tel que paramétré par la RFC 7518, section 4.6.2.
+func concatKDF(z []byte, algorithm string, apu, apv []byte, size int) []byte {
+	var otherInfo []byte
+	for _, field := range [][]byte{[]byte(algorithm), apu, apv} {
+		otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(len(field)))
+		otherInfo = append(otherInfo, field...)
+	}
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(size*8))
+
+	var key []byte
+	for counter := uint32(1); len(key) < size; counter++ {
+		h := sha256.New()
+		h.Write(binary.BigEndian.AppendUint32(nil, counter))
+		h.Write(z)
+		h.Write(otherInfo)
+		key = h.Sum(key)
+	}
+	return key[:size]
+}
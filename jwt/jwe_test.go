@@ -0,0 +1,194 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedTokenRSA(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	data := map[string]interface{}{"phone": "+221770000000"}
+
+	token, err := j.GenerateEncryptedToken(data, Subject("user-1"))
+	assert.NoError(t, err)
+	parts := strings.Split(token, ".")
+	assert.Len(t, parts, 5)
+	header := decodeJWEHeader(t, token)
+	assert.Equal(t, jweAlgRSAOAEP256, header.Alg)
+	assert.Equal(t, jweEncA256GCM, header.Enc)
+	assert.Equal(t, "JWT", header.Cty)
+	for _, part := range parts {
+		decoded, _ := base64.RawURLEncoding.DecodeString(part)
+		assert.NotContains(t, string(decoded), "+221770000000")
+	}
+
+	claims, err := j.ValidateEncryptedToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, data, claims["data"])
+	assert.Equal(t, "user-1", claims["sub"])
+
+	// Un token chiffré n'est pas un token signé, et inversement.
+	_, err = j.ValidateToken(token)
+	assert.Error(t, err)
+	signed, err := j.GenerateToken(data)
+	assert.NoError(t, err)
+	_, err = j.ValidateEncryptedToken(signed)
+	assert.Error(t, err)
+}
+
+func TestEncryptedTokenECDHES(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+			assert.NoError(t, err)
+			j := New(time.Hour)
+			j.OnError(func(error) {})
+			j.privateKey = privateKey
+			j.publicKey = &privateKey.PublicKey
+
+			token, err := j.GenerateEncryptedToken("secret")
+			assert.NoError(t, err)
+			header := decodeJWEHeader(t, token)
+			assert.Equal(t, jweAlgECDHES, header.Alg)
+			assert.NotNil(t, header.Epk)
+			assert.Empty(t, strings.Split(token, ".")[1])
+
+			claims, err := j.ValidateEncryptedToken(token)
+			assert.NoError(t, err)
+			assert.Equal(t, "secret", claims["data"])
+		})
+	}
+}
+
+func TestEncryptedTokenRejectsTampering(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	token, err := j.GenerateEncryptedToken("secret")
+	assert.NoError(t, err)
+	parts := strings.Split(token, ".")
+
+	ciphertext, _ := base64.RawURLEncoding.DecodeString(parts[3])
+	ciphertext[0] ^= 1
+	tampered := append([]string{}, parts...)
+	tampered[3] = base64.RawURLEncoding.EncodeToString(ciphertext)
+	_, err = j.ValidateEncryptedToken(strings.Join(tampered, "."))
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+	assert.ErrorIs(t, err, ErrTokenSignatureInvalid)
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(err))
+
+	// L'en-tête est authentifié : le modifier invalide le tag.
+	header := decodeJWEHeader(t, token)
+	header.Kid = "other"
+	headerJSON, _ := json.Marshal(header)
+	tampered = append([]string{}, parts...)
+	tampered[0] = base64.RawURLEncoding.EncodeToString(headerJSON)
+	_, err = j.ValidateEncryptedToken(strings.Join(tampered, "."))
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	// Un algorithme non pris en charge ou un JWE compact mal formé est refusé, pas indisponible.
+	header = decodeJWEHeader(t, token)
+	header.Enc = "A128CBC-HS256"
+	headerJSON, _ = json.Marshal(header)
+	tampered[0] = base64.RawURLEncoding.EncodeToString(headerJSON)
+	_, err = j.ValidateEncryptedToken(strings.Join(tampered, "."))
+	assert.ErrorIs(t, err, ErrTokenMalformed)
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(err))
+	_, err = j.ValidateEncryptedToken(strings.Join(parts[:4], "."))
+	assert.ErrorIs(t, err, ErrTokenMalformed)
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(err))
+
+	other := newTestTools(t, time.Hour)
+	_, err = other.ValidateEncryptedToken(token)
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(err))
+}
+
+func TestEncryptedTokenValidatesInnerClaims(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	now := time.Now()
+	j.now = func() time.Time { return now }
+	token, err := j.GenerateEncryptedToken("secret", Audience("billing"))
+	assert.NoError(t, err)
+
+	_, err = j.ValidateEncryptedToken(token, ExpectAudiences("orders"))
+	assertValidationError(t, err, jwtlib.ValidationErrorAudience)
+
+	j.now = func() time.Time { return now.Add(2 * time.Hour) }
+	_, err = j.ValidateEncryptedToken(token)
+	assertValidationError(t, err, jwtlib.ValidationErrorExpired)
+}
+
+func TestWithEncryptionKeys(t *testing.T) {
+	recipientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	// L'émetteur signe avec sa propre clé et chiffre pour le destinataire.
+	issuer := newTestTools(t, time.Hour)
+	issuer.encryptTo = &recipientKey.PublicKey
+	token, err := issuer.GenerateEncryptedToken("secret")
+	assert.NoError(t, err)
+
+	recipient := New(time.Hour, WithEncryptionKeys(nil, recipientKey))
+	recipient.OnError(func(error) {})
+	recipient.publicKey = issuer.publicKey
+	claims, err := recipient.ValidateEncryptedToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", claims["data"])
+
+	_, err = issuer.ValidateEncryptedToken(token)
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+}
+
+func TestEncryptedTokenUnsupportedKey(t *testing.T) {
+	j := New(time.Hour)
+	j.OnError(func(error) {})
+	secret := []byte(strings.Repeat("s", minHMACSecretLength))
+	j.privateKey, j.publicKey = secret, secret
+
+	_, err := j.GenerateEncryptedToken("secret")
+	assert.Error(t, err)
+}
+
+func TestEncryptedTokenMissingDecryptionKey(t *testing.T) {
+	issuer := newTestTools(t, time.Hour)
+	token, err := issuer.GenerateEncryptedToken("secret")
+	assert.NoError(t, err)
+
+	// Sans clé de déchiffrement, le serveur est mal configuré : le token n'est pas en cause.
+	j := New(time.Hour)
+	j.OnError(func(error) {})
+	_, err = j.ValidateEncryptedToken(token)
+	assert.Error(t, err)
+	var tokenErr *TokenError
+	assert.False(t, errors.As(err, &tokenErr))
+	assert.Equal(t, http.StatusServiceUnavailable, StatusCode(err))
+}
+
+// TestConcatKDF reprend l'exemple ECDH-ES de la RFC 7518, annexe C.
+func TestConcatKDF(t *testing.T) {
+	z := []byte{158, 86, 217, 29, 129, 113, 53, 211, 114, 131, 66, 131, 191, 132,
+		38, 156, 251, 49, 110, 163, 218, 128, 106, 72, 246, 218, 167, 121,
+		140, 254, 144, 196}
+	key := concatKDF(z, "A128GCM", []byte("Alice"), []byte("Bob"), 16)
+	assert.Equal(t, "VqqN6vgjbSBcIijNcacQGg", base64.RawURLEncoding.EncodeToString(key))
+}
+
+func decodeJWEHeader(t *testing.T, token string) jweHeader {
+	t.Helper()
+	headerJSON, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	assert.NoError(t, err)
+	var header jweHeader
+	assert.NoError(t, json.Unmarshal(headerJSON, &header))
+	return header
+}
@@ -0,0 +1,390 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSRefreshInterval    = 15 * time.Minute
+	defaultJWKSMinRefreshInterval = time.Minute
+)
+
+// JWK représente une clé publique au format JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet représente un document JWKS.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK convertit une clé publique RSA, ECDSA ou Ed25519 en JWK de signature.
+// Les secrets HMAC ne sont jamais exportés.
+func NewJWK(kid string, publicKey crypto.PublicKey) (JWK, error) {
+	method, err := signingMethod(publicKey)
+	if err != nil {
+		return JWK{}, err
+	}
+	jwk := JWK{Kid: kid, Use: "sig", Alg: method.Alg()}
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = k.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	default:
+		return JWK{}, fmt.Errorf("key type %T cannot be exported as a JWK", publicKey)
+	}
+	return jwk, nil
+}
+
+// PublicKey retourne la clé publique décrite par le JWK.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA JWK")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported JWK curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		publicKey := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		// ECDH refuse les points qui ne sont pas sur la courbe.
+		if _, err := publicKey.ECDH(); err != nil {
+			return nil, errors.New("invalid EC JWK")
+		}
+		return publicKey, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported JWK curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 JWK")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported JWK key type %q", k.Kty)
+	}
+}
+
+// Thumbprint calcule l'empreinte SHA-256 du JWK (RFC 7638), encodée en base64url.
+func (k JWK) Thumbprint() string {
+	// Les membres requis sont sérialisés dans l'ordre lexicographique, sans espace.
+	var canonical string
+	switch k.Kty {
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k.Crv, k.Kty, k.X, k.Y)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, k.Crv, k.Kty, k.X)
+	default:
+		canonical = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, k.E, k.Kty, k.N)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS retourne les clés publiques de vérification de l'instance :
+// celles du trousseau encore acceptées et la clé chargée par les méthodes Load*.
+func (j *Tools) JWKS() *JWKSet {
+	set := &JWKSet{Keys: []JWK{}}
+	if j.keyRing != nil {
+		for _, key := range j.keyRing.VerificationKeys(j.now()) {
+			if jwk, err := NewJWK(key.ID, key.PublicKey); err == nil {
+				set.Keys = append(set.Keys, jwk)
+			}
+		}
+	}
+	if publicKey := j.legacyPublicKey(); publicKey != nil {
+		if jwk, err := NewJWK(legacyKeyID(publicKey), publicKey); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// JWKSHandler sert le document JWKS de l'instance, typiquement sur /.well-known/jwks.json.
+func (j *Tools) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if err := json.NewEncoder(w).Encode(j.JWKS()); err != nil {
+			j.errChan <- err
+		}
+	})
+}
+
+// legacyPublicKey retourne la clé publique chargée hors trousseau, déduite de la clé privée si besoin.
+func (j *Tools) legacyPublicKey() crypto.PublicKey {
+	privateKey, publicKey := j.loadedKeys()
+	if publicKey != nil {
+		return publicKey
+	}
+	if privateKey != nil {
+		if publicKey, err := publicKeyOf(privateKey); err == nil {
+			return publicKey
+		}
+	}
+	return nil
+}
+
+// legacyKeyID calcule le kid de la clé chargée hors trousseau : son empreinte RFC 7638.
+// Les secrets HMAC n'ont pas de kid.
+func legacyKeyID(publicKey crypto.PublicKey) string {
+	jwk, err := NewJWK("", publicKey)
+	if err != nil {
+		return ""
+	}
+	return jwk.Thumbprint()
+}
+
+// JWKSClientOption configure un JWKSClient.
+type JWKSClientOption func(*JWKSClient)
+
+// JWKSHTTPClient définit le client HTTP utilisé pour télécharger le JWKS.
+func JWKSHTTPClient(client *http.Client) JWKSClientOption {
+	return func(c *JWKSClient) {
+		c.httpClient = client
+	}
+}
+
+// JWKSRefreshInterval définit la durée pendant laquelle le JWKS téléchargé est conservé.
+func JWKSRefreshInterval(interval time.Duration) JWKSClientOption {
+	return func(c *JWKSClient) {
+		c.refreshInterval = interval
+	}
+}
+
+// JWKSMinRefreshInterval définit le délai minimal entre deux téléchargements,
+// qu'ils soient déclenchés par un JWKS périmé ou par un kid inconnu.
+func JWKSMinRefreshInterval(interval time.Duration) JWKSClientOption {
+	return func(c *JWKSClient) {
+		c.minRefreshInterval = interval
+	}
+}
+
+// JWKSClient télécharge, met en cache et rafraîchit un JWKS distant.
+type JWKSClient struct {
+	url                string
+	httpClient         *http.Client
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	now                func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]*Key // remplacé, jamais modifié, à chaque téléchargement
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	lastErr     error      // erreur du dernier téléchargement
+	inflight    *jwksFetch // téléchargement en cours, nil sinon
+}
+
+// jwksFetch est un téléchargement en cours, attendu par les appels concurrents.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewJWKSClient crée un client pour le JWKS publié à l'URL donnée.
+func NewJWKSClient(url string, opts ...JWKSClientOption) *JWKSClient {
+	c := &JWKSClient{
+		url:                url,
+		httpClient:         &http.Client{Timeout: 10 * time.Second},
+		refreshInterval:    defaultJWKSRefreshInterval,
+		minRefreshInterval: defaultJWKSMinRefreshInterval,
+		now:                time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Key retourne la clé de vérification identifiée par kid. Le JWKS est téléchargé à nouveau
+// lorsqu'il est périmé ou que le kid est inconnu, au plus une fois par JWKSMinRefreshInterval :
+// tant que le JWKS distant est injoignable, les clés déjà téléchargées restent utilisées.
+func (c *JWKSClient) Key(kid string) (*Key, error) {
+	now := c.now()
+	keys, fetchedAt := c.cached()
+	attempted := false
+	if keys == nil || now.Sub(fetchedAt) >= c.refreshInterval {
+		var err error
+		attempted, err = c.fetch(now, false)
+		keys, _ = c.cached()
+		if keys == nil {
+			return nil, err
+		}
+	}
+	if key, ok := keys[kid]; ok {
+		found := *key
+		return &found, nil
+	}
+	if !attempted {
+		fetched, err := c.fetch(now, false)
+		if fetched && err != nil {
+			return nil, err
+		}
+		keys, _ = c.cached()
+		if key, ok := keys[kid]; ok {
+			found := *key
+			return &found, nil
+		}
+	}
+	return nil, ErrUnknownKeyID
+}
+
+// Refresh télécharge immédiatement le JWKS.
+func (c *JWKSClient) Refresh() error {
+	_, err := c.fetch(c.now(), true)
+	return err
+}
+
+// cached retourne les clés téléchargées et la date de leur téléchargement.
+func (c *JWKSClient) cached() (map[string]*Key, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keys, c.fetchedAt
+}
+
+// fetch télécharge le JWKS hors du verrou. Un appel concurrent attend le téléchargement en cours
+// plutôt que d'en lancer un autre ; sans force, aucun téléchargement n'a lieu moins de
+// minRefreshInterval après le précédent et l'erreur de ce dernier est retournée.
+// attempted indique si l'appel a téléchargé le JWKS ou attendu un téléchargement.
+func (c *JWKSClient) fetch(now time.Time, force bool) (attempted bool, err error) {
+	c.mu.Lock()
+	if call := c.inflight; call != nil {
+		c.mu.Unlock()
+		<-call.done
+		return true, call.err
+	}
+	if !force && now.Sub(c.attemptedAt) < c.minRefreshInterval {
+		err := c.lastErr
+		c.mu.Unlock()
+		return false, err
+	}
+	call := &jwksFetch{done: make(chan struct{})}
+	c.inflight = call
+	c.attemptedAt = now
+	c.mu.Unlock()
+
+	keys, err := c.download()
+
+	c.mu.Lock()
+	if err == nil {
+		c.keys = keys
+		c.fetchedAt = now
+	}
+	c.lastErr = err
+	c.inflight = nil
+	c.mu.Unlock()
+	call.err = err
+	close(call.done)
+	return true, err
+}
+
+// download télécharge le JWKS et retourne ses clés de signature prises en charge.
+func (c *JWKSClient) download() (map[string]*Key, error) {
+	resp, err := c.httpClient.Get(c.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS: unexpected status %s", resp.Status)
+	}
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*Key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kid == "" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		// Les clés d'un type non pris en charge, ou annonçant un algorithme différent
+		// de celui imposé par leur type, sont ignorées.
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		method, err := signingMethod(publicKey)
+		if err != nil || (jwk.Alg != "" && jwk.Alg != method.Alg()) {
+			continue
+		}
+		keys[jwk.Kid] = &Key{ID: jwk.Kid, PublicKey: publicKey}
+	}
+	return keys, nil
+}
@@ -0,0 +1,171 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWKSHandler(t *testing.T) {
+	// Setup
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	keyRing, err := NewKeyRing(Key{ID: "ring", PrivateKey: privateKey})
+	assert.NoError(t, err)
+	j := newTestTools(t, time.Hour)
+	j.keyRing = keyRing
+
+	// Test
+	rec := httptest.NewRecorder()
+	j.JWKSHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var set JWKSet
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &set))
+	assert.Len(t, set.Keys, 2)
+	assert.Equal(t, "ring", set.Keys[0].Kid)
+	assert.Equal(t, legacyKeyID(j.publicKey), set.Keys[1].Kid)
+
+	publicKey, err := set.Keys[0].PublicKey()
+	assert.NoError(t, err)
+	assert.True(t, privateKey.PublicKey.Equal(publicKey))
+
+	rec = httptest.NewRecorder()
+	j.JWKSHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestJWKSClient(t *testing.T) {
+	// Setup: the issuer publishes its keys, the verifier only knows the JWKS URL.
+	issuer := newTestTools(t, time.Hour)
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		issuer.JWKSHandler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := NewJWKSClient(server.URL, JWKSMinRefreshInterval(0))
+	verifier := New(time.Hour, WithJWKSClient(client))
+	verifier.OnError(func(error) {})
+
+	// Test
+	token, err := issuer.GenerateToken("testData")
+	assert.NoError(t, err)
+	claims, err := verifier.ValidateToken(token)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "testData", claims["data"])
+
+	_, err = verifier.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches), "the key set is cached")
+
+	// A new issuer key is picked up by refetching on an unknown kid.
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	keyRing, err := NewKeyRing(Key{ID: "rotated", PrivateKey: rotated})
+	assert.NoError(t, err)
+	issuer.keyRing = keyRing
+	token, err = issuer.GenerateToken("testData")
+	assert.NoError(t, err)
+	_, err = verifier.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	_, err = client.Key("missing")
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+}
+
+func TestJWKSClientBacksOffWhenUnavailable(t *testing.T) {
+	issuer := newTestTools(t, time.Hour)
+	var fetches int32
+	var failing atomic.Bool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if failing.Load() {
+			<-release
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		issuer.JWKSHandler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	client := NewJWKSClient(server.URL, JWKSRefreshInterval(time.Minute), JWKSMinRefreshInterval(10*time.Second))
+	client.now = func() time.Time { return now }
+	kid := legacyKeyID(issuer.publicKey)
+	_, err := client.Key(kid)
+	assert.NoError(t, err)
+
+	// Le JWKS est périmé et le serveur ne répond plus : les appels concurrents attendent
+	// un seul téléchargement, puis les clés déjà téléchargées restent utilisées.
+	failing.Store(true)
+	now = now.Add(2 * time.Minute)
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Key(kid)
+			assert.NoError(t, err)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	// Le téléchargement suivant attend JWKSMinRefreshInterval, même pour un kid inconnu.
+	for range 5 {
+		_, err = client.Key(kid)
+		assert.NoError(t, err)
+		_, err = client.Key("missing")
+		assert.ErrorIs(t, err, ErrUnknownKeyID)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	now = now.Add(11 * time.Second)
+	_, err = client.Key(kid)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fetches))
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	for _, publicKey := range []crypto.PublicKey{&ecKey.PublicKey, edPublic} {
+		// Test
+		jwk, err := NewJWK("kid", publicKey)
+		assert.NoError(t, err)
+		parsed, err := jwk.PublicKey()
+
+		// Assert
+		assert.NoError(t, err)
+		assert.True(t, publicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(parsed))
+		assert.NotEmpty(t, jwk.Thumbprint())
+	}
+
+	_, err = NewJWK("kid", make([]byte, 32))
+	assert.Error(t, err, "symmetric keys cannot be exported")
+}
@@ -1,62 +1,158 @@
 package jwt
 
 import (
-	"crypto/rsa"
+	"crypto"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"os"
-
+	"sync"
 	"time"
 
-	"github.com/abdotop/tools/jwt/utils"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// jwt_tools est une structure qui contient la clé privée et la clé publique.
-type jwt_tools struct {
-	privateKey *rsa.PrivateKey
-	publicKey  *rsa.PublicKey
+// TokenIssuer émet des tokens. Tools l'implémente ; les services qui ne font qu'émettre
+// des tokens peuvent dépendre de cette interface plutôt que de Tools.
+type TokenIssuer interface {
+	GenerateToken(data interface{}, opts ...TokenOption) (string, error)
+	IssueTokenPair(data interface{}, opts ...TokenOption) (*TokenPair, error)
+	RefreshTokenPair(refreshToken string, opts ...TokenOption) (*TokenPair, error)
+}
+
+// TokenVerifier valide des tokens. Tools l'implémente.
+type TokenVerifier interface {
+	ValidateToken(tokenString string, opts ...ValidateOption) (jwt.MapClaims, error)
+}
+
+var (
+	_ TokenIssuer   = (*Tools)(nil)
+	_ TokenVerifier = (*Tools)(nil)
+)
+
+// Tools émet et valide des tokens ; elle contient la clé privée et la clé publique.
+// Les clés peuvent être RSA, ECDSA, Ed25519 ou un secret HMAC ([]byte) ;
+// l'algorithme de signature est déterminé par le type de la clé.
+// Le package jwttest fournit une instance de test à horloge fixe et clé déterministe.
+type Tools struct {
+	keyMu      sync.RWMutex
+	privateKey crypto.PrivateKey
+	publicKey  crypto.PublicKey
 	errChan    chan error // Channel to send errors
-	exp        int64
+	ttl        time.Duration
+	now        func() time.Time
+
+	issuer            string
+	audience          []string
+	expectedIssuers   []string
+	expectedAudiences []string
+	leeway            time.Duration
+
+	keyRing      *KeyRing
+	jwksClient   *JWKSClient
+	refreshTTL   time.Duration
+	refreshStore RefreshStore
+
+	revocationStore RevocationStore
+
+	encryptTo   crypto.PublicKey
+	decryptWith crypto.PrivateKey
+
+	codeStore CodeStore
+	codeTTL   time.Duration
+
+	dpopReplay  ReplayCache
+	dpopMaxAge  time.Duration
+	dpopBaseURL string
+
+	format    Format
+	localKeys map[string][]byte
+	localKid  string
+
+	sessionStore SessionStore
+
+	purposeReplay ReplayCache
+
+	tokenCache *tokenCache
+
+	tenants *TenantRegistry
 }
 
-// New crée une nouvelle instance de jwt_tools.
-func New(exp uint16) *jwt_tools {
-	return &jwt_tools{
-		errChan: make(chan error),
-		exp:     time.Now().Add(time.Hour * time.Duration(exp)).Unix(),
+// New crée une nouvelle instance de Tools dont les tokens sont valides pendant ttl.
+func New(ttl time.Duration, opts ...Option) *Tools {
+	j := &Tools{
+		errChan:       make(chan error),
+		ttl:           ttl,
+		now:           time.Now,
+		refreshTTL:    defaultRefreshTTL,
+		refreshStore:  NewMemoryRefreshStore(),
+		codeStore:     NewMemoryCodeStore(),
+		codeTTL:       defaultCodeTTL,
+		dpopReplay:    NewMemoryReplayCache(),
+		purposeReplay: NewMemoryReplayCache(),
+		dpopMaxAge:    defaultDPoPProofMaxAge,
 	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
 }
 
 // LoadPrivateKeyFromEnv charge la clé privée depuis l'environnement.
-func (j *jwt_tools) LoadPrivateKeyFromEnv(key string) error {
-	if key == "" {
-		err := errors.New("key is empty")
-		j.errChan <- err
-		return err
+func (j *Tools) LoadPrivateKeyFromEnv(key string) error {
+	return j.loadPrivateKey(EnvKeySource{Name: key})
+}
+
+// LoadPublicKeyFromEnv charge la clé publique depuis l'environnement.
+func (j *Tools) LoadPublicKeyFromEnv(key string) error {
+	return j.loadPublicKey(EnvKeySource{Name: key})
+}
+
+func (j *Tools) LoadPrivateKeyFromSecretsManager(secretName string) error {
+	return j.loadPrivateKey(SecretsManagerKeySource{SecretName: secretName})
+}
+
+func (j *Tools) LoadPublicKeyFromSecretsManager(secretName string) error {
+	return j.loadPublicKey(SecretsManagerKeySource{SecretName: secretName})
+}
+
+// loadPrivateKey charge uniquement la clé privée fournie par la source.
+func (j *Tools) loadPrivateKey(src KeySource) error {
+	material, err := src.LoadKeys()
+	if err == nil && material.PrivateKey == nil {
+		err = errors.New("no private key found")
 	}
-	base64Key := os.Getenv(key)
-	if base64Key == "" {
-		err := errors.New("key not found")
-		j.errChan <- err
-		return err
+	if err == nil {
+		err = checkKeyTypes(material.PrivateKey)
 	}
-	keyData, err := base64.StdEncoding.DecodeString(base64Key)
 	if err != nil {
 		j.errChan <- err
 		return err
 	}
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyData)
+	j.setKeys(material.PrivateKey, nil)
+	return nil
+}
+
+// loadPublicKey charge uniquement la clé publique fournie par la source.
+func (j *Tools) loadPublicKey(src KeySource) error {
+	material, err := src.LoadKeys()
+	if err == nil && material.PublicKey == nil {
+		err = errors.New("no public key found")
+	}
+	if err == nil {
+		err = checkKeyTypes(material.PublicKey)
+	}
 	if err != nil {
 		j.errChan <- err
 		return err
 	}
-	j.privateKey = privateKey
+	j.setKeys(nil, material.PublicKey)
 	return nil
 }
 
-// LoadPublicKeyFromEnv charge la clé publique depuis l'environnement.
-func (j *jwt_tools) LoadPublicKeyFromEnv(key string) error {
+// LoadHMACSecretFromEnv charge un secret HMAC encodé en base64 depuis l'environnement.
+// Les tokens sont alors signés et vérifiés en HS256.
+func (j *Tools) LoadHMACSecretFromEnv(key string) error {
 	if key == "" {
 		err := errors.New("key is empty")
 		j.errChan <- err
@@ -68,101 +164,357 @@ func (j *jwt_tools) LoadPublicKeyFromEnv(key string) error {
 		j.errChan <- err
 		return err
 	}
-	keyData, err := base64.StdEncoding.DecodeString(base64Key)
+	return j.loadHMACSecret(base64Key)
+}
+
+// LoadHMACSecretFromSecretsManager charge un secret HMAC encodé en base64 depuis AWS Secrets Manager.
+func (j *Tools) LoadHMACSecretFromSecretsManager(secretName string) error {
+	secret, err := getSecret(secretName)
 	if err != nil {
 		j.errChan <- err
 		return err
 	}
-	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(keyData)
+	return j.loadHMACSecret(secret)
+}
+
+func (j *Tools) loadHMACSecret(base64Secret string) error {
+	secret, err := base64.StdEncoding.DecodeString(base64Secret)
 	if err != nil {
 		j.errChan <- err
 		return err
 	}
-	j.publicKey = publicKey
+	if err := checkKeyTypes(secret); err != nil {
+		j.errChan <- err
+		return err
+	}
+	j.setKeys(secret, secret)
 	return nil
 }
 
-func (j *jwt_tools) LoadPrivateKeyFromSecretsManager(secretName string) error {
-	secret, err := utils.GetSecret(secretName)
+// GenerateToken génère un nouveau token JWT.
+// Les claims exp, iat et nbf sont calculés au moment de la signature.
+func (j *Tools) GenerateToken(data interface{}, opts ...TokenOption) (string, error) {
+	tokenString, _, err := j.generate(data, j.newTokenConfig(opts))
 	if err != nil {
 		j.errChan <- err
-		return err
+		return "", err
+	}
+	return tokenString, nil
+}
+
+// generate signe un token avec la configuration donnée et retourne sa date d'expiration.
+func (j *Tools) generate(data interface{}, cfg *tokenConfig) (string, time.Time, error) {
+	if cfg.err != nil {
+		return "", time.Time{}, cfg.err
+	}
+	if cfg.ttl <= 0 {
+		return "", time.Time{}, errors.New("token ttl must be positive")
+	}
+	var signer *tenant
+	if j.tenants != nil {
+		if j.format != FormatJWT {
+			return "", time.Time{}, errors.New("tenants require the JWT format")
+		}
+		var err error
+		if signer, err = j.signingTenant(cfg); err != nil {
+			return "", time.Time{}, err
+		}
+		cfg.issuer = signer.issuer
+	}
+	now := j.now()
+	exp := now.Add(cfg.ttl)
+	notBefore := now
+	if !cfg.notBefore.IsZero() {
+		notBefore = cfg.notBefore
+	}
+	claims := jwt.MapClaims{
+		"data": data,
+		"exp":  exp.Unix(),
+		"iat":  now.Unix(),
+		"nbf":  notBefore.Unix(),
+		"jti":  newID(),
+	}
+	if cfg.issuer != "" {
+		claims["iss"] = cfg.issuer
+	}
+	if cfg.subject != "" {
+		claims["sub"] = cfg.subject
+	}
+	switch len(cfg.audience) {
+	case 0:
+	case 1:
+		claims["aud"] = cfg.audience[0]
+	default:
+		claims["aud"] = cfg.audience
+	}
+	for name, value := range cfg.claims {
+		claims[name] = value
+	}
+
+	if j.format != FormatJWT {
+		tokenString, err := j.sealPASETO(claims, now)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		return tokenString, exp, nil
+	}
+
+	signingKey, kid, err := j.signingKey(now)
+	if signer != nil {
+		var key *Key
+		if key, err = signer.keyRing.SigningKey(now); err == nil {
+			signingKey, kid = key.PrivateKey, key.ID
+		}
 	}
-	keyData, err := base64.StdEncoding.DecodeString(secret)
 	if err != nil {
-		j.errChan <- err
-		return err
+		return "", time.Time{}, err
 	}
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyData)
+	method, err := signingMethod(signingKey)
 	if err != nil {
-		j.errChan <- err
-		return err
+		return "", time.Time{}, err
 	}
-	j.privateKey = privateKey
-	return nil
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	tokenString, err := token.SignedString(signingKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, exp, nil
 }
 
-func (j *jwt_tools) LoadPublicKeyFromSecretsManager(secretName string) error {
-	secret, err := utils.GetSecret(secretName)
+// ValidateToken valide un token JWT et retourne les claims s'il est valide.
+// Les claims exp, iat, nbf, iss et aud sont vérifiés selon les attentes de l'instance,
+// que les options peuvent remplacer pour cet appel.
+// Les refresh tokens sont refusés : ils ne peuvent servir qu'à RefreshTokenPair ;
+// de même pour les tokens émis par PurposeTokens.
+// Un token lié à une clé DPoP (claim cnf.jkt) n'est accepté qu'avec l'option DPoPProofKey.
+// Un token refusé donne une *TokenError dont la raison se teste avec errors.Is
+// (ErrTokenExpired, ErrTokenSignatureInvalid, ErrUnknownKeyID, etc.).
+func (j *Tools) ValidateToken(tokenString string, opts ...ValidateOption) (jwt.MapClaims, error) {
+	claims, err := j.validate(tokenString, j.newValidateConfig(opts))
 	if err != nil {
 		j.errChan <- err
-		return err
+		return nil, err
 	}
-	keyData, err := base64.StdEncoding.DecodeString(secret)
+	return claims, nil
+}
+
+// CheckToken valide un token comme ValidateToken, sans publier l'erreur sur le callback d'OnError.
+// Il est destiné aux points d'entrée exposés aux clients (intercepteurs gRPC, files de messages) :
+// un token invalide y est un événement ordinaire, qui ne doit ni bloquer l'appel ni inonder le callback.
+func (j *Tools) CheckToken(tokenString string, opts ...ValidateOption) (jwt.MapClaims, error) {
+	return j.validate(tokenString, j.newValidateConfig(opts))
+}
+
+// validate applique toutes les vérifications de ValidateToken sans publier l'erreur.
+func (j *Tools) validate(tokenString string, cfg *validateConfig) (jwt.MapClaims, error) {
+	claims, err := j.parse(tokenString, cfg)
 	if err != nil {
-		j.errChan <- err
-		return err
+		return nil, err
 	}
-	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(keyData)
-	if err != nil {
-		j.errChan <- err
-		return err
+	var tokenErr *TokenError
+	switch claims[tokenUseClaim] {
+	case nil, tokenUseAccess:
+		tokenErr = checkBinding(claims, cfg)
+	case tokenUseRefresh:
+		tokenErr = &TokenError{Reason: ErrNotAccessToken, Claim: tokenUseClaim,
+			Err: jwt.NewValidationError("refresh token cannot be used as an access token", jwt.ValidationErrorClaimsInvalid)}
+	default:
+		tokenErr = &TokenError{Reason: ErrNotAccessToken, Claim: tokenUseClaim,
+			Err: jwt.NewValidationError("token cannot be used as an access token", jwt.ValidationErrorClaimsInvalid)}
 	}
-	j.publicKey = publicKey
-	return nil
+	if tokenErr != nil {
+		tokenErr.KeyID, tokenErr.Algorithm = j.tokenHeader(tokenString)
+		return nil, tokenErr
+	}
+	return claims, nil
 }
 
-// GenerateToken génère un nouveau token JWT.
-func (j *jwt_tools) GenerateToken(data interface{}) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
-		"data": data,
-		"exp":  j.exp,
-	})
+// parse vérifie la signature et les claims enregistrés d'un token puis retourne ses claims.
+func (j *Tools) parse(tokenString string, cfg *validateConfig) (jwt.MapClaims, error) {
+	claims, err := j.verify(tokenString)
+	if err != nil {
+		return nil, j.tokenError(tokenString, err)
+	}
+	if err := j.validateClaims(claims, cfg); err != nil {
+		return nil, j.tokenError(tokenString, err)
+	}
+	if err := j.checkRevocation(claims); err != nil {
+		return nil, j.tokenError(tokenString, err)
+	}
+	if err := j.checkSession(claims); err != nil {
+		return nil, j.tokenError(tokenString, err)
+	}
+	return claims, nil
+}
 
-	tokenString, err := token.SignedString(j.privateKey)
+// verify vérifie la signature (ou déchiffre) le token et retourne ses claims,
+// en passant par le cache des tokens vérifiés s'il est activé.
+func (j *Tools) verify(tokenString string) (jwt.MapClaims, error) {
+	if j.tokenCache != nil {
+		// La clé qui a vérifié le token doit toujours être acceptée : un token dont la clé a été
+		// retirée du trousseau, du JWKS ou de son tenant depuis sa mise en cache est vérifié à nouveau, donc refusé.
+		if entry, ok := j.tokenCache.get(tokenString, j.now()); ok {
+			key, err := j.currentKey(entry.kid, stringClaim(entry.claims, "iss"))
+			if err == nil && sameKey(key, entry.verifier) {
+				return entry.claims, nil
+			}
+			j.tokenCache.remove(tokenString)
+		}
+	}
+	var claims jwt.MapClaims
+	var key interface{}
+	var err error
+	if j.format == FormatJWT {
+		claims, key, err = j.parseJWT(tokenString)
+	} else {
+		claims, key, err = j.openPASETO(tokenString)
+	}
 	if err != nil {
-		j.errChan <- err
-		return "", err
+		return nil, err
 	}
-	return tokenString, nil
+	if j.tokenCache != nil {
+		// L'entrée retient la clé qui a effectivement vérifié le token, même si les clés ont changé depuis.
+		kid, _ := j.tokenHeader(tokenString)
+		j.tokenCache.add(tokenString, claims, kid, key)
+	}
+	return claims, nil
 }
 
-// ValidateToken valide un token JWT et retourne les claims s'il est valide.
-func (j *jwt_tools) ValidateToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			err := jwt.NewValidationError("unexpected signing method", jwt.ValidationErrorSignatureInvalid)
-			j.errChan <- err
+// currentKey retourne la clé qui vérifie aujourd'hui un token de kid et d'émetteur donnés,
+// selon le format de l'instance.
+func (j *Tools) currentKey(kid, issuer string) (interface{}, error) {
+	switch j.format {
+	case FormatPASETOLocal:
+		key, ok := j.localKeys[kid]
+		if !ok {
+			return nil, ErrUnknownKeyID
+		}
+		return key, nil
+	case FormatPASETOPublic:
+		return j.verificationKeyByID(kid)
+	default:
+		return j.issuerVerificationKey(issuer, kid)
+	}
+}
+
+// sameKey indique si a et b sont la même clé publique ou le même secret.
+func sameKey(a, b interface{}) bool {
+	if secret, ok := a.([]byte); ok {
+		other, ok := b.([]byte)
+		return ok && subtle.ConstantTimeCompare(secret, other) == 1
+	}
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// parseJWT vérifie la signature d'un JWT et retourne ses claims, sans vérifier les claims enregistrés,
+// ainsi que la clé qui a vérifié la signature.
+func (j *Tools) parseJWT(tokenString string) (jwt.MapClaims, crypto.PublicKey, error) {
+	var verifiedWith crypto.PublicKey
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		key, err := j.verificationKey(token)
+		if err != nil {
 			return nil, err
 		}
-		return j.publicKey, nil
+		// L'algorithme est imposé par la clé, jamais par l'en-tête du token.
+		method, err := signingMethod(key)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != method.Alg() {
+			return nil, jwt.NewValidationError("unexpected signing method", jwt.ValidationErrorSignatureInvalid)
+		}
+		verifiedWith = key
+		return key, nil
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, nil, jwt.NewValidationError("invalid token", jwt.ValidationErrorMalformed)
+	}
+	return claims, verifiedWith, nil
+}
 
+// signingKey retourne la clé de signature active et son kid :
+// celle du trousseau s'il est configuré, sinon la clé chargée par les méthodes Load*.
+func (j *Tools) signingKey(now time.Time) (crypto.PrivateKey, string, error) {
+	if j.keyRing != nil {
+		key, err := j.keyRing.SigningKey(now)
+		if err != nil {
+			return nil, "", err
+		}
+		return key.PrivateKey, key.ID, nil
+	}
+	privateKey, _ := j.loadedKeys()
+	if privateKey == nil {
+		return nil, "", errors.New("private key not loaded")
+	}
+	publicKey, err := publicKeyOf(privateKey)
 	if err != nil {
-		j.errChan <- err
-		return nil, err
+		return nil, "", err
 	}
+	return privateKey, legacyKeyID(publicKey), nil
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
-	} else {
-		err := jwt.NewValidationError("invalid token", jwt.ValidationErrorMalformed)
-		j.errChan <- err
-		return nil, err
+// verificationKey sélectionne la clé publique à utiliser d'après le kid du token :
+// trousseau, clé chargée par les méthodes Load* puis JWKS distant.
+// Sans kid, la clé chargée par les méthodes Load* est utilisée.
+// Avec WithTenants, seul le trousseau du tenant dont l'émetteur est le claim iss est consulté.
+func (j *Tools) verificationKey(token *jwt.Token) (crypto.PublicKey, error) {
+	kid, _ := token.Header["kid"].(string)
+	claims, _ := token.Claims.(jwt.MapClaims)
+	return j.issuerVerificationKey(stringClaim(claims, "iss"), kid)
+}
+
+// issuerVerificationKey sélectionne la clé publique d'un JWT d'émetteur et de kid donnés, comme verificationKey.
+func (j *Tools) issuerVerificationKey(issuer, kid string) (crypto.PublicKey, error) {
+	if j.tenants != nil {
+		key, err := j.tenantVerificationKey(issuer, kid)
+		if err != nil {
+			return nil, err
+		}
+		return key.PublicKey, nil
+	}
+	return j.verificationKeyByID(kid)
+}
+
+// verificationKeyByID sélectionne la clé publique correspondant à kid, comme verificationKey.
+func (j *Tools) verificationKeyByID(kid string) (crypto.PublicKey, error) {
+	_, publicKey := j.loadedKeys()
+	if kid != "" {
+		if j.keyRing != nil {
+			if key, err := j.keyRing.VerificationKey(kid, j.now()); err == nil {
+				return key.PublicKey, nil
+			}
+		}
+		if publicKey != nil && kid == legacyKeyID(publicKey) {
+			return publicKey, nil
+		}
+		if j.jwksClient != nil {
+			key, err := j.jwksClient.Key(kid)
+			if err != nil {
+				return nil, err
+			}
+			return key.PublicKey, nil
+		}
+		if j.keyRing != nil {
+			return nil, ErrUnknownKeyID
+		}
+	}
+	if publicKey == nil {
+		return nil, errors.New("public key not loaded")
 	}
+	return publicKey, nil
 }
 
-func (j *jwt_tools) OnError(callback func(error)) {
+func (j *Tools) OnError(callback func(error)) {
 	go func() {
 		for err := range j.errChan { // Correctly range over the channel
 			if err != nil {
@@ -1,10 +1,14 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/base64"
 	"os"
 	"testing"
+	"time"
 
+	jwtlib "github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -54,7 +58,7 @@ ss3EEpCrzbIhrDZgb0+aMCk=
 	os.Setenv(key, base64.StdEncoding.EncodeToString([]byte(expectedKey)))
 	defer os.Unsetenv(key)
 
-	j := &jwt_tools{}
+	j := &Tools{}
 
 	// Test
 	err := j.LoadPrivateKeyFromEnv(key)
@@ -80,7 +84,7 @@ XFz14mS86EY/wgKTYnonLBjvrk75fx23pX9SktJO7k3PqissHe1jF7mTOlUq9Dpj
 	os.Setenv(key, base64.StdEncoding.EncodeToString([]byte(expectedKey)))
 	defer os.Unsetenv(key)
 
-	j := &jwt_tools{}
+	j := &Tools{}
 
 	// Test
 	err := j.LoadPublicKeyFromEnv(key)
@@ -125,7 +129,7 @@ ss3EEpCrzbIhrDZgb0+aMCk=
 	os.Setenv(key, base64.StdEncoding.EncodeToString([]byte(expectedKey)))
 	defer os.Unsetenv(key)
 
-	j := New(1)
+	j := New(time.Hour)
 
 	// Test
 	err := j.LoadPrivateKeyFromEnv(key)
@@ -189,7 +193,7 @@ XFz14mS86EY/wgKTYnonLBjvrk75fx23pX9SktJO7k3PqissHe1jF7mTOlUq9Dpj
 	os.Setenv(key2, base64.StdEncoding.EncodeToString([]byte(expectedKey2)))
 	defer os.Unsetenv(key2)
 
-	j := New(1)
+	j := New(time.Hour)
 
 	// Test
 	err := j.LoadPrivateKeyFromEnv(key)
@@ -221,7 +225,7 @@ func TestLoadPrivateKeyFromSecretsManager(t *testing.T) {
 	mockUtils := new(MockUtils)
 	mockUtils.On("GetSecret", "TEST_SECRET").Return("fakePrivateKey", nil)
 
-	j := &jwt_tools{}
+	j := &Tools{}
 
 	// Test
 	err := j.LoadPrivateKeyFromSecretsManager("TEST_SECRET")
@@ -237,7 +241,7 @@ func TestLoadPublicKeyFromSecretsManager(t *testing.T) {
 	mockUtils := new(MockUtils)
 	mockUtils.On("GetSecret", "TEST_SECRET").Return("fakePublicKey", nil)
 
-	j := &jwt_tools{}
+	j := &Tools{}
 
 	// Test
 	err := j.LoadPublicKeyFromSecretsManager("TEST_SECRET")
@@ -247,3 +251,73 @@ func TestLoadPublicKeyFromSecretsManager(t *testing.T) {
 	assert.NotNil(t, j.publicKey)
 	mockUtils.AssertExpectations(t)
 }
+
+func TestGenerateTokenTTL(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	now := time.Unix(1700000000, 0)
+	j.now = func() time.Time { return now }
+
+	// Test
+	token, err := j.GenerateToken("testData")
+	assert.NoError(t, err)
+	short, err := j.GenerateToken("testData", TTL(5*time.Minute))
+	assert.NoError(t, err)
+
+	// Assert
+	claims := unverifiedClaims(t, token)
+	assert.Equal(t, float64(now.Add(time.Hour).Unix()), claims["exp"])
+	assert.Equal(t, float64(now.Unix()), claims["iat"])
+	assert.Equal(t, float64(now.Unix()), claims["nbf"])
+	assert.Equal(t, float64(now.Add(5*time.Minute).Unix()), unverifiedClaims(t, short)["exp"])
+}
+
+func TestGenerateTokenComputesExpiryAtSigningTime(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	now := time.Unix(1700000000, 0)
+	j.now = func() time.Time { return now }
+
+	// Test
+	first, err := j.GenerateToken("testData")
+	assert.NoError(t, err)
+	now = now.Add(2 * time.Hour)
+	second, err := j.GenerateToken("testData")
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, float64(now.Add(time.Hour).Unix()), unverifiedClaims(t, second)["exp"])
+	assert.NotEqual(t, unverifiedClaims(t, first)["exp"], unverifiedClaims(t, second)["exp"])
+}
+
+func TestGenerateTokenRejectsNonPositiveTTL(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+
+	// Test
+	_, err := j.GenerateToken("testData", TTL(0))
+
+	// Assert
+	assert.Error(t, err)
+}
+
+// newTestTools crée une instance avec une paire de clés RSA générée pour le test.
+func newTestTools(t *testing.T, ttl time.Duration) *Tools {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	j := New(ttl)
+	j.OnError(func(error) {})
+	j.privateKey = privateKey
+	j.publicKey = &privateKey.PublicKey
+	return j
+}
+
+// unverifiedClaims décode les claims d'un token sans vérifier sa signature.
+func unverifiedClaims(t *testing.T, token string) jwtlib.MapClaims {
+	t.Helper()
+	claims := jwtlib.MapClaims{}
+	_, _, err := jwtlib.NewParser().ParseUnverified(token, claims)
+	assert.NoError(t, err)
+	return claims
+}
@@ -0,0 +1,90 @@
+// Package jwttest fournit un faux service de tokens pour les tests unitaires des services
+// qui dépendent de jwt.TokenIssuer ou jwt.TokenVerifier : une vraie instance de jwt.Tools, en mémoire,
+// avec une horloge fixe contrôlée par le test et une clé Ed25519 déterministe.
+package jwttest
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abdotop/tools/jwt"
+)
+
+// DefaultTTL est la durée de validité des tokens émis par New.
+const DefaultTTL = time.Hour
+
+// Epoch est l'instant initial de l'horloge de New.
+var Epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Key retourne une clé Ed25519 déterministe dérivée de name : deux appels avec le même nom
+// retournent la même clé, y compris d'une exécution à l'autre.
+func Key(name string) ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte("jwttest:" + name))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// Clock est une horloge qui n'avance que sur demande du test.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock crée une horloge arrêtée à now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now retourne l'instant courant de l'horloge.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance avance l'horloge de d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set place l'horloge à now.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Fake est une instance de jwt.Tools configurée pour les tests. Elle implémente
+// jwt.TokenIssuer et jwt.TokenVerifier ; ses erreurs sont retournées mais jamais publiées.
+type Fake struct {
+	*jwt.Tools
+	Clock      *Clock
+	PrivateKey ed25519.PrivateKey
+}
+
+// New crée un Fake dont les tokens, signés par Key("default"), sont valides pendant DefaultTTL
+// à partir d'Epoch. Les options s'appliquent après celles du fake et peuvent les remplacer.
+func New(opts ...jwt.Option) *Fake {
+	clock := NewClock(Epoch)
+	tools := jwt.New(DefaultTTL, append([]jwt.Option{jwt.WithClock(clock.Now)}, opts...)...)
+	tools.OnError(func(error) {})
+	key := Key("default")
+	if err := tools.LoadKeySource(jwt.StaticKeySource{PrivateKey: key}); err != nil {
+		panic(err)
+	}
+	return &Fake{Tools: tools, Clock: clock, PrivateKey: key}
+}
+
+// Token émet un token pour data et interrompt le test en cas d'erreur.
+func (f *Fake) Token(tb testing.TB, data interface{}, opts ...jwt.TokenOption) string {
+	tb.Helper()
+	token, err := f.GenerateToken(data, opts...)
+	if err != nil {
+		tb.Fatalf("jwttest: generate token: %v", err)
+	}
+	return token
+}
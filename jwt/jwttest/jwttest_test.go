@@ -0,0 +1,57 @@
+package jwttest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/abdotop/tools/jwt"
+)
+
+// greeter est un service qui dépend seulement d'un jwt.TokenVerifier.
+type greeter struct {
+	tokens jwt.TokenVerifier
+}
+
+func (g *greeter) greet(token string) (string, error) {
+	claims, err := g.tokens.ValidateToken(token)
+	if err != nil {
+		return "", err
+	}
+	return "hello " + claims["sub"].(string), nil
+}
+
+func TestFake(t *testing.T) {
+	fake := New(jwt.WithIssuer("auth"))
+	var _ jwt.TokenIssuer = fake
+
+	token := fake.Token(t, nil, jwt.Subject("user-1"))
+	g := &greeter{tokens: fake}
+	greeting, err := g.greet(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello user-1", greeting)
+
+	claims, err := fake.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "auth", claims["iss"])
+	assert.Equal(t, float64(Epoch.Unix()), claims["iat"])
+	assert.Equal(t, float64(Epoch.Add(DefaultTTL).Unix()), claims["exp"])
+
+	// L'horloge n'avance que sur demande.
+	fake.Clock.Advance(DefaultTTL + time.Second)
+	_, err = g.greet(token)
+	assert.Error(t, err)
+}
+
+func TestDeterministicKeys(t *testing.T) {
+	assert.Equal(t, Key("default"), Key("default"))
+	assert.NotEqual(t, Key("default"), Key("other"))
+
+	// Deux fakes partagent la même clé : un token de l'un est accepté par l'autre.
+	first, second := New(), New()
+	token := first.Token(t, "data")
+	_, err := second.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, first.JWKS(), second.JWKS())
+}
@@ -0,0 +1,168 @@
+package jwt
+
+import (
+	"crypto"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownKeyID est retournée lorsqu'aucune clé active ne correspond au kid d'un token.
+	ErrUnknownKeyID = errors.New("unknown key id")
+	// ErrNoSigningKey est retournée lorsqu'aucune clé du trousseau ne peut signer.
+	ErrNoSigningKey = errors.New("no active signing key")
+)
+
+// Key est une clé du trousseau, identifiée par son kid.
+//
+// Une clé signe à partir de ActivateAt (immédiatement si la date est nulle) jusqu'à ce
+// qu'une clé activée plus récemment la remplace. Elle reste acceptée pour la vérification
+// jusqu'à RetireAt (indéfiniment si la date est nulle).
+type Key struct {
+	ID         string
+	PrivateKey crypto.PrivateKey // nil pour une clé de vérification seule
+	PublicKey  crypto.PublicKey
+	ActivateAt time.Time
+	RetireAt   time.Time
+}
+
+// retired indique si la clé n'est plus acceptée à la date now.
+func (k *Key) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// KeyRing regroupe plusieurs clés indexées par kid, dont une seule signe à un instant donné.
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys map[string]*Key
+}
+
+// NewKeyRing crée un trousseau contenant les clés données.
+func NewKeyRing(keys ...Key) (*KeyRing, error) {
+	kr := &KeyRing{
+		keys: make(map[string]*Key),
+	}
+	for _, key := range keys {
+		if err := kr.Add(key); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+// Add ajoute une clé au trousseau. La clé publique est déduite de la clé privée si elle est absente.
+func (kr *KeyRing) Add(key Key) error {
+	if key.ID == "" {
+		return errors.New("key id is empty")
+	}
+	if key.PublicKey == nil && key.PrivateKey != nil {
+		publicKey, err := publicKeyOf(key.PrivateKey)
+		if err != nil {
+			return err
+		}
+		key.PublicKey = publicKey
+	}
+	if key.PublicKey == nil {
+		return errors.New("key " + key.ID + " has no public key")
+	}
+	if _, err := signingMethod(key.PublicKey); err != nil {
+		return err
+	}
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if _, ok := kr.keys[key.ID]; ok {
+		return errors.New("key " + key.ID + " already exists")
+	}
+	kr.keys[key.ID] = &key
+	return nil
+}
+
+// Promote programme l'activation d'une clé comme clé de signature à la date at.
+func (kr *KeyRing) Promote(kid string, at time.Time) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	key, ok := kr.keys[kid]
+	if !ok {
+		return ErrUnknownKeyID
+	}
+	if key.PrivateKey == nil {
+		return errors.New("key " + kid + " has no private key")
+	}
+	key.ActivateAt = at
+	return nil
+}
+
+// Retire programme le retrait d'une clé à la date at : elle ne signe ni ne vérifie plus ensuite.
+func (kr *KeyRing) Retire(kid string, at time.Time) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	key, ok := kr.keys[kid]
+	if !ok {
+		return ErrUnknownKeyID
+	}
+	key.RetireAt = at
+	return nil
+}
+
+// Prune supprime du trousseau les clés retirées à la date now.
+func (kr *KeyRing) Prune(now time.Time) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	for kid, key := range kr.keys {
+		if key.retired(now) {
+			delete(kr.keys, kid)
+		}
+	}
+}
+
+// SigningKey retourne la clé de signature active à la date now :
+// la clé privée non retirée dont la date d'activation est la plus récente.
+func (kr *KeyRing) SigningKey(now time.Time) (*Key, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	var active *Key
+	for _, key := range kr.keys {
+		if key.PrivateKey == nil || key.retired(now) || key.ActivateAt.After(now) {
+			continue
+		}
+		if active == nil || key.ActivateAt.After(active.ActivateAt) ||
+			(key.ActivateAt.Equal(active.ActivateAt) && key.ID > active.ID) {
+			active = key
+		}
+	}
+	if active == nil {
+		return nil, ErrNoSigningKey
+	}
+	signing := *active
+	return &signing, nil
+}
+
+// VerificationKey retourne la clé identifiée par kid si elle est encore acceptée à la date now.
+func (kr *KeyRing) VerificationKey(kid string, now time.Time) (*Key, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	key, ok := kr.keys[kid]
+	if !ok || key.retired(now) {
+		return nil, ErrUnknownKeyID
+	}
+	verification := *key
+	return &verification, nil
+}
+
+// VerificationKeys retourne, triées par kid, les clés encore acceptées à la date now.
+func (kr *KeyRing) VerificationKeys(now time.Time) []Key {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	keys := make([]Key, 0, len(kr.keys))
+	for _, key := range kr.keys {
+		if !key.retired(now) {
+			keys = append(keys, *key)
+		}
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		return keys[a].ID < keys[b].ID
+	})
+	return keys
+}
@@ -0,0 +1,89 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyRingRotation(t *testing.T) {
+	// Setup
+	now := time.Unix(1700000000, 0)
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	keyRing, err := NewKeyRing(
+		Key{ID: "old", PrivateKey: oldKey},
+		Key{ID: "new", PrivateKey: newKey, ActivateAt: now.Add(time.Hour)},
+	)
+	assert.NoError(t, err)
+	j := New(2*time.Hour, WithKeyRing(keyRing))
+	j.OnError(func(error) {})
+	j.now = func() time.Time { return now }
+
+	// Test: the old key signs until the new one is promoted.
+	before, err := j.GenerateToken("testData")
+	assert.NoError(t, err)
+	assert.Equal(t, "old", tokenKeyID(t, before))
+
+	now = now.Add(time.Hour)
+	after, err := j.GenerateToken("testData")
+	assert.NoError(t, err)
+	assert.Equal(t, "new", tokenKeyID(t, after))
+
+	// Assert: tokens in flight remain valid during the rotation.
+	_, err = j.ValidateToken(before)
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(after)
+	assert.NoError(t, err)
+
+	// Retiring the old key rejects the tokens it signed.
+	assert.NoError(t, keyRing.Retire("old", now))
+	_, err = j.ValidateToken(before)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+	_, err = j.ValidateToken(after)
+	assert.NoError(t, err)
+
+	keyRing.Prune(now)
+	_, err = keyRing.VerificationKey("old", now.Add(-time.Hour))
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+}
+
+func TestKeyRingPromote(t *testing.T) {
+	// Setup
+	now := time.Unix(1700000000, 0)
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	keyRing, err := NewKeyRing(Key{ID: "verify-only", PublicKey: &privateKey.PublicKey})
+	assert.NoError(t, err)
+
+	// Test
+	_, err = keyRing.SigningKey(now)
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+	assert.Error(t, keyRing.Promote("verify-only", now))
+	assert.ErrorIs(t, keyRing.Promote("missing", now), ErrUnknownKeyID)
+
+	assert.NoError(t, keyRing.Add(Key{ID: "signer", PrivateKey: privateKey, ActivateAt: now.Add(time.Hour)}))
+	assert.NoError(t, keyRing.Promote("signer", now))
+
+	// Assert
+	key, err := keyRing.SigningKey(now)
+	assert.NoError(t, err)
+	assert.Equal(t, "signer", key.ID)
+	assert.Error(t, keyRing.Add(Key{ID: "signer", PrivateKey: privateKey}), "duplicate kid")
+}
+
+// tokenKeyID retourne le kid de l'en-tête d'un token.
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwtlib.NewParser().ParseUnverified(token, jwtlib.MapClaims{})
+	assert.NoError(t, err)
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
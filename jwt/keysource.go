@@ -0,0 +1,307 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/abdotop/tools/jwt/utils"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// getSecret lit un secret AWS Secrets Manager ; remplacé dans les tests.
+var getSecret = utils.GetSecret
+
+// KeyMaterial contient les clés fournies par une KeySource. L'une des deux peut être nil ;
+// la clé publique est déduite de la clé privée quand la source ne la fournit pas.
+type KeyMaterial struct {
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+// KeySource fournit les clés de signature et de vérification d'une instance.
+type KeySource interface {
+	LoadKeys() (*KeyMaterial, error)
+}
+
+// modTimer est implémentée par les sources adossées à un fichier :
+// WatchKeySource ne recharge la source que lorsque la date de modification change.
+type modTimer interface {
+	ModTime() (time.Time, error)
+}
+
+// EnvKeySource lit une clé PEM dans une variable d'environnement, encodée en base64 ou en clair.
+type EnvKeySource struct {
+	Name string
+}
+
+func (s EnvKeySource) LoadKeys() (*KeyMaterial, error) {
+	if s.Name == "" {
+		return nil, errors.New("key is empty")
+	}
+	value := os.Getenv(s.Name)
+	if value == "" {
+		return nil, errors.New("key not found")
+	}
+	return decodeKeyMaterial([]byte(value))
+}
+
+// FileKeySource lit une clé dans un fichier PEM ou DER. Un fichier PEM peut contenir
+// la clé privée et la clé publique (ou le certificat).
+type FileKeySource struct {
+	Path string
+}
+
+func (s FileKeySource) LoadKeys() (*KeyMaterial, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKeyMaterial(data)
+}
+
+func (s FileKeySource) ModTime() (time.Time, error) {
+	return fileModTime(s.Path)
+}
+
+// PKCS12KeySource lit une clé privée et son certificat dans un fichier PKCS#12 (.p12, .pfx).
+type PKCS12KeySource struct {
+	Path     string
+	Password string
+}
+
+func (s PKCS12KeySource) LoadKeys() (*KeyMaterial, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, cert, err := pkcs12.Decode(data, s.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyMaterial{PrivateKey: privateKey, PublicKey: cert.PublicKey}, nil
+}
+
+func (s PKCS12KeySource) ModTime() (time.Time, error) {
+	return fileModTime(s.Path)
+}
+
+// StaticKeySource fournit des clés déjà en mémoire, par exemple dans les tests.
+// Un secret HMAC ([]byte) se passe comme clé privée.
+type StaticKeySource struct {
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+func (s StaticKeySource) LoadKeys() (*KeyMaterial, error) {
+	if s.PrivateKey == nil && s.PublicKey == nil {
+		return nil, errors.New("no key found")
+	}
+	return completeKeyMaterial(&KeyMaterial{PrivateKey: s.PrivateKey, PublicKey: s.PublicKey})
+}
+
+// SecretsManagerKeySource lit une clé PEM, encodée en base64 ou en clair, dans AWS Secrets Manager.
+type SecretsManagerKeySource struct {
+	SecretName string
+}
+
+func (s SecretsManagerKeySource) LoadKeys() (*KeyMaterial, error) {
+	secret, err := getSecret(s.SecretName)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKeyMaterial([]byte(secret))
+}
+
+// LoadKeySource charge les clés fournies par la source. Seules les clés présentes
+// dans la source remplacent celles de l'instance.
+func (j *Tools) LoadKeySource(src KeySource) error {
+	if err := j.loadKeySource(src); err != nil {
+		j.errChan <- err
+		return err
+	}
+	return nil
+}
+
+func (j *Tools) loadKeySource(src KeySource) error {
+	material, err := src.LoadKeys()
+	if err != nil {
+		return err
+	}
+	if err := checkKeyTypes(material.PrivateKey, material.PublicKey); err != nil {
+		return err
+	}
+	j.setKeys(material.PrivateKey, material.PublicKey)
+	return nil
+}
+
+// checkKeyTypes vérifie que chaque clé non nulle peut signer ou vérifier un token, afin qu'une clé
+// d'un type non pris en charge soit refusée au chargement plutôt qu'à la première signature.
+func checkKeyTypes(keys ...interface{}) error {
+	for _, key := range keys {
+		if key == nil {
+			continue
+		}
+		if _, err := signingMethod(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WatchKeySource charge la source puis la recharge toutes les interval, ce qui permet
+// une rotation des clés sans redémarrage. Les sources adossées à un fichier ne sont relues
+// que si le fichier a changé. Les erreurs de rechargement sont publiées sur le callback
+// d'OnError et les clés précédentes restent en service. La fonction retournée arrête la surveillance.
+func (j *Tools) WatchKeySource(src KeySource, interval time.Duration) (stop func(), err error) {
+	var lastMod time.Time
+	if mt, ok := src.(modTimer); ok {
+		if lastMod, err = mt.ModTime(); err != nil {
+			j.errChan <- err
+			return nil, err
+		}
+	}
+	if err := j.LoadKeySource(src); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if mt, ok := src.(modTimer); ok {
+				modTime, err := mt.ModTime()
+				if err == nil && modTime.Equal(lastMod) {
+					continue
+				}
+				if err == nil {
+					lastMod = modTime
+				} else {
+					j.publishError(err, done)
+					continue
+				}
+			}
+			if err := j.loadKeySource(src); err != nil {
+				j.publishError(err, done)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+// publishError envoie une erreur d'arrière-plan au callback d'OnError sans bloquer l'arrêt.
+func (j *Tools) publishError(err error, done <-chan struct{}) {
+	select {
+	case j.errChan <- err:
+	case <-done:
+	}
+}
+
+// loadedKeys retourne les clés chargées hors trousseau.
+func (j *Tools) loadedKeys() (crypto.PrivateKey, crypto.PublicKey) {
+	j.keyMu.RLock()
+	defer j.keyMu.RUnlock()
+	return j.privateKey, j.publicKey
+}
+
+// setKeys remplace les clés chargées hors trousseau ; une clé nil laisse la clé actuelle en place.
+func (j *Tools) setKeys(privateKey crypto.PrivateKey, publicKey crypto.PublicKey) {
+	j.keyMu.Lock()
+	defer j.keyMu.Unlock()
+	if privateKey != nil {
+		j.privateKey = privateKey
+	}
+	if publicKey != nil {
+		j.publicKey = publicKey
+	}
+	// Les tokens vérifiés avec l'ancienne clé doivent l'être à nouveau.
+	if j.tokenCache != nil {
+		j.tokenCache.purge()
+	}
+}
+
+// decodeKeyMaterial décode des clés PEM (éventuellement encodées en base64) ou DER.
+func decodeKeyMaterial(data []byte) (*KeyMaterial, error) {
+	// Une clé DER est binaire et peut se terminer par un octet d'espacement : elle est lue telle quelle.
+	material := &KeyMaterial{}
+	if err := material.add(data); err == nil {
+		return completeKeyMaterial(material)
+	}
+	data = bytes.TrimSpace(data)
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		if decoded, err := base64.StdEncoding.DecodeString(string(data)); err == nil {
+			data = decoded
+		}
+	}
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		if err := material.add(data); err != nil {
+			return nil, err
+		}
+		return completeKeyMaterial(material)
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if err := material.add(block.Bytes); err != nil {
+			return nil, fmt.Errorf("PEM block %q: %w", block.Type, err)
+		}
+	}
+	if material.PrivateKey == nil && material.PublicKey == nil {
+		return nil, errors.New("key must be PEM encoded")
+	}
+	return completeKeyMaterial(material)
+}
+
+// add ajoute une clé DER : la première clé privée et la première clé publique sont retenues.
+func (m *KeyMaterial) add(der []byte) error {
+	if privateKey, err := parsePrivateKeyDER(der); err == nil {
+		if m.PrivateKey == nil {
+			m.PrivateKey = privateKey
+		}
+		return nil
+	}
+	publicKey, err := parsePublicKeyDER(der)
+	if err != nil {
+		return errors.New("unsupported key format")
+	}
+	if m.PublicKey == nil {
+		m.PublicKey = publicKey
+	}
+	return nil
+}
+
+// completeKeyMaterial déduit la clé publique de la clé privée si elle manque.
+func completeKeyMaterial(m *KeyMaterial) (*KeyMaterial, error) {
+	if m.PrivateKey != nil && m.PublicKey == nil {
+		publicKey, err := publicKeyOf(m.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		m.PublicKey = publicKey
+	}
+	return m, nil
+}
+
+func fileModTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,278 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvKeySource(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	for name, value := range map[string]string{
+		"base64": base64.StdEncoding.EncodeToString(pemKey),
+		"raw":    string(pemKey),
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("TEST_KEY_SOURCE", value)
+			material, err := EnvKeySource{Name: "TEST_KEY_SOURCE"}.LoadKeys()
+			assert.NoError(t, err)
+			assert.True(t, privateKey.Equal(material.PrivateKey))
+			assert.True(t, privateKey.PublicKey.Equal(material.PublicKey))
+		})
+	}
+
+	_, err = EnvKeySource{Name: "TEST_KEY_SOURCE_MISSING"}.LoadKeys()
+	assert.EqualError(t, err, "key not found")
+	t.Setenv("TEST_KEY_SOURCE", "bm90IGEga2V5")
+	_, err = EnvKeySource{Name: "TEST_KEY_SOURCE"}.LoadKeys()
+	assert.Error(t, err)
+}
+
+func TestFileKeySource(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+	certDER := selfSignedCertificate(t, privateKey)
+	dir := t.TempDir()
+
+	// Un fichier PEM peut regrouper la clé privée et le certificat.
+	bundle := filepath.Join(dir, "bundle.pem")
+	assert.NoError(t, os.WriteFile(bundle, append(
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})...), 0o600))
+	material, err := FileKeySource{Path: bundle}.LoadKeys()
+	assert.NoError(t, err)
+	assert.True(t, privateKey.Equal(material.PrivateKey))
+	assert.True(t, privateKey.PublicKey.Equal(material.PublicKey))
+
+	certFile := filepath.Join(dir, "cert.der")
+	assert.NoError(t, os.WriteFile(certFile, certDER, 0o600))
+	material, err = FileKeySource{Path: certFile}.LoadKeys()
+	assert.NoError(t, err)
+	assert.Nil(t, material.PrivateKey)
+	assert.True(t, privateKey.PublicKey.Equal(material.PublicKey))
+
+	// Un fichier DER qui se termine par un octet d'espacement n'est pas tronqué.
+	var edPublic ed25519.PublicKey
+	for edPublic == nil || edPublic[len(edPublic)-1] != '\n' {
+		edPublic, _, err = ed25519.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+	}
+	edDER, err := x509.MarshalPKIXPublicKey(edPublic)
+	assert.NoError(t, err)
+	edFile := filepath.Join(dir, "ed25519.der")
+	assert.NoError(t, os.WriteFile(edFile, edDER, 0o600))
+	material, err = FileKeySource{Path: edFile}.LoadKeys()
+	if assert.NoError(t, err) {
+		assert.True(t, edPublic.Equal(material.PublicKey))
+	}
+
+	_, err = FileKeySource{Path: filepath.Join(dir, "missing.pem")}.LoadKeys()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestPKCS12KeySource(t *testing.T) {
+	material, err := PKCS12KeySource{Path: "testdata/rsa.p12", Password: "secret"}.LoadKeys()
+	assert.NoError(t, err)
+	privateKey, ok := material.PrivateKey.(*rsa.PrivateKey)
+	if assert.True(t, ok) {
+		assert.True(t, privateKey.PublicKey.Equal(material.PublicKey))
+	}
+
+	_, err = PKCS12KeySource{Path: "testdata/rsa.p12", Password: "wrong"}.LoadKeys()
+	assert.Error(t, err)
+}
+
+func TestAWSSecretKeySource(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+	secret := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	stubSecret(t, map[string]string{"jwt/signing": secret})
+
+	material, err := SecretsManagerKeySource{SecretName: "jwt/signing"}.LoadKeys()
+	assert.NoError(t, err)
+	assert.True(t, privateKey.Equal(material.PrivateKey))
+
+	_, err = SecretsManagerKeySource{SecretName: "jwt/unknown"}.LoadKeys()
+	assert.Error(t, err)
+}
+
+func TestLoadKeySource(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	j := New(time.Hour)
+	j.OnError(func(error) {})
+
+	assert.NoError(t, j.LoadKeySource(StaticKeySource{PrivateKey: privateKey}))
+	token, err := j.GenerateToken("data")
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(token)
+	assert.NoError(t, err)
+
+	// Une source publique seule ne remplace pas la clé privée.
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	assert.NoError(t, j.LoadKeySource(StaticKeySource{PublicKey: &other.PublicKey}))
+	current, _ := j.loadedKeys()
+	assert.Equal(t, privateKey, current)
+	_, err = j.ValidateToken(token)
+	assert.Error(t, err)
+
+	assert.Error(t, j.LoadKeySource(StaticKeySource{PrivateKey: []byte("short")}))
+	assert.Error(t, j.LoadKeySource(StaticKeySource{}))
+	assert.NoError(t, j.LoadKeySource(StaticKeySource{PrivateKey: []byte(strings.Repeat("s", minHMACSecretLength))}))
+	token, err = j.GenerateToken("data")
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(token)
+	assert.NoError(t, err)
+}
+
+func TestLoadKeyRejectsUnsupportedType(t *testing.T) {
+	// P-224 n'a pas d'algorithme JWS : la clé est refusée dès son chargement.
+	privateKey, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+	t.Setenv("P224_PRIVATE_KEY", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})))
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.NoError(t, err)
+	t.Setenv("P224_PUBLIC_KEY", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})))
+
+	j := New(time.Hour)
+	j.OnError(func(error) {})
+	assert.ErrorContains(t, j.LoadPrivateKeyFromEnv("P224_PRIVATE_KEY"), "curve")
+	assert.ErrorContains(t, j.LoadPublicKeyFromEnv("P224_PUBLIC_KEY"), "curve")
+	privateLoaded, publicLoaded := j.loadedKeys()
+	assert.Nil(t, privateLoaded)
+	assert.Nil(t, publicLoaded)
+}
+
+func TestLoadKeysFromAWSSecret(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+	stubSecret(t, map[string]string{
+		"private": base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"public":  base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshalPKIX(t, &privateKey.PublicKey)})),
+	})
+	j := New(time.Hour)
+	j.OnError(func(error) {})
+
+	assert.NoError(t, j.LoadPublicKeyFromSecretsManager("public"))
+	assert.Error(t, j.LoadPrivateKeyFromSecretsManager("public"))
+	assert.NoError(t, j.LoadPrivateKeyFromSecretsManager("private"))
+	token, err := j.GenerateToken("data")
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(token)
+	assert.NoError(t, err)
+}
+
+func TestWatchKeySource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	first := writeECKeyFile(t, path)
+	j := New(time.Hour)
+	j.OnError(func(error) {})
+
+	stop, err := j.WatchKeySource(FileKeySource{Path: path}, 10*time.Millisecond)
+	assert.NoError(t, err)
+	defer stop()
+	current, _ := j.loadedKeys()
+	assert.True(t, first.Equal(current))
+
+	second := writeECKeyFile(t, path)
+	// La date de modification est avancée pour ne pas dépendre de la résolution du système de fichiers.
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	assert.Eventually(t, func() bool {
+		current, _ := j.loadedKeys()
+		return second.Equal(current)
+	}, time.Second, 10*time.Millisecond)
+
+	// Un fichier invalide ne remplace pas les clés en service.
+	errs := make(chan error, 1)
+	j2 := New(time.Hour)
+	j2.OnError(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	stop2, err := j2.WatchKeySource(FileKeySource{Path: path}, 10*time.Millisecond)
+	assert.NoError(t, err)
+	defer stop2()
+	assert.NoError(t, os.WriteFile(path, []byte("garbage"), 0o600))
+	evenLater := later.Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, evenLater, evenLater))
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("reload error was not reported")
+	}
+	current, _ = j2.loadedKeys()
+	assert.True(t, second.Equal(current))
+
+	_, err = j.WatchKeySource(FileKeySource{Path: filepath.Join(t.TempDir(), "missing.pem")}, time.Second)
+	assert.Error(t, err)
+}
+
+func writeECKeyFile(t *testing.T, path string) *ecdsa.PrivateKey {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(privateKey)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600))
+	return privateKey
+}
+
+func selfSignedCertificate(t *testing.T, privateKey *rsa.PrivateKey) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "jwt-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	assert.NoError(t, err)
+	return der
+}
+
+// stubSecret remplace l'accès à AWS Secrets Manager pendant le test.
+func stubSecret(t *testing.T, secrets map[string]string) {
+	t.Helper()
+	previous := getSecret
+	getSecret = func(name string) (string, error) {
+		secret, ok := secrets[name]
+		if !ok {
+			return "", errors.New("secret not found")
+		}
+		return secret, nil
+	}
+	t.Cleanup(func() { getSecret = previous })
+}
@@ -0,0 +1,328 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type contextKey int
+
+const (
+	claimsContextKey contextKey = iota
+	tokenContextKey
+)
+
+const (
+	scopeClaim    = "scope"
+	rolesClaim    = "roles"
+	clientIDClaim = "client_id"
+
+	bearerScheme = "Bearer"
+	dpopScheme   = "DPoP"
+)
+
+// MiddlewareOption configure le middleware d'authentification.
+type MiddlewareOption func(*middlewareConfig)
+
+// middlewareConfig regroupe les paramètres du middleware d'authentification.
+type middlewareConfig struct {
+	realm         string
+	cookie        string
+	query         string
+	validateOpts  []ValidateOption
+	requireDPoP   bool
+	renewWithin   time.Duration
+	maxLifetime   time.Duration
+	idleTimeout   time.Duration
+	renewedCookie *CookieAttributes
+}
+
+// Realm définit le realm annoncé dans l'en-tête WWW-Authenticate.
+func Realm(realm string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.realm = realm
+	}
+}
+
+// TokenFromCookie accepte aussi le token dans le cookie donné.
+func TokenFromCookie(name string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.cookie = name
+	}
+}
+
+// TokenFromQuery accepte aussi le token dans le paramètre d'URL donné (RFC 6750, section 2.3).
+func TokenFromQuery(name string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.query = name
+	}
+}
+
+// RequireDPoP refuse les tokens présentés avec le schéma Bearer : seuls les tokens
+// liés à une clé et accompagnés d'une preuve DPoP sont acceptés.
+func RequireDPoP() MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.requireDPoP = true
+	}
+}
+
+// ValidateWith applique des options de validation à chaque requête.
+func ValidateWith(opts ...ValidateOption) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.validateOpts = opts
+	}
+}
+
+// Middleware authentifie les requêtes HTTP : le token est lu dans l'en-tête
+// Authorization (schéma Bearer ou DPoP), puis dans le cookie ou le paramètre d'URL configurés.
+// Les claims d'un token valide sont placés dans le contexte de la requête ;
+// sinon la requête est refusée avec un en-tête WWW-Authenticate conforme à la RFC 6750,
+// ou avec le code 503 si le token n'a pas pu être vérifié (voir StatusCode).
+//
+// Un token lié à une clé (claim cnf.jkt, voir DPoPKey) doit être présenté avec le schéma DPoP
+// et une preuve signée par cette clé dans l'en-tête DPoP (RFC 9449).
+//
+// Avec SlidingExpiry et IdleTimeout, le middleware renouvelle les tokens proches de l'expiration
+// et déconnecte les sessions inactives.
+func (j *Tools) Middleware(opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := &middlewareConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString, scheme, err := cfg.extractToken(r)
+			challenge := bearerScheme
+			if cfg.requireDPoP || scheme == dpopScheme {
+				challenge = dpopScheme
+			}
+			if err != nil {
+				writeChallenge(w, challenge, cfg.realm, http.StatusBadRequest, "invalid_request", err.Error(), "")
+				return
+			}
+			if tokenString == "" {
+				writeChallenge(w, challenge, cfg.realm, http.StatusUnauthorized, "", "", "")
+				return
+			}
+			if cfg.requireDPoP && scheme != dpopScheme {
+				writeChallenge(w, challenge, cfg.realm, http.StatusUnauthorized, "invalid_token", "a DPoP-bound token is required", "")
+				return
+			}
+			validateOpts := cfg.validateOpts
+			if scheme == dpopScheme {
+				proofKey, err := j.dpopRequest(r, tokenString)
+				if err != nil {
+					writeChallenge(w, challenge, cfg.realm, http.StatusUnauthorized, "invalid_dpop_proof", err.Error(), "")
+					return
+				}
+				validateOpts = append(slices.Clip(validateOpts), DPoPProofKey(proofKey))
+			}
+			claims, err := j.validate(tokenString, j.newValidateConfig(validateOpts))
+			if err != nil {
+				// Un token lié à une clé ne doit jamais être accepté comme simple bearer token.
+				if errors.Is(err, ErrTokenBindingMismatch) {
+					challenge = dpopScheme
+				}
+				writeValidationError(w, challenge, cfg.realm, err)
+				return
+			}
+			if cfg.idleTimeout > 0 {
+				if err := j.checkIdle(claims, cfg.idleTimeout); err != nil {
+					writeValidationError(w, challenge, cfg.realm, err)
+					return
+				}
+			}
+			if cfg.renewWithin > 0 {
+				// Un échec de renouvellement n'empêche pas la requête : le token présenté reste valide.
+				if renewed, exp, err := j.renew(claims, cfg.renewWithin, cfg.maxLifetime); err == nil && renewed != "" {
+					cfg.writeRenewedToken(w, r, tokenString, renewed, exp)
+				}
+			}
+			ctx := context.WithValue(ContextWithClaims(r.Context(), claims), tokenContextKey, tokenString)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// extractToken lit le token de la requête et le schéma avec lequel il a été présenté.
+// Utiliser plusieurs méthodes à la fois est une erreur.
+func (c *middlewareConfig) extractToken(r *http.Request) (string, string, error) {
+	type presented struct{ token, scheme string }
+	var tokens []presented
+	if scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok {
+		switch {
+		case strings.EqualFold(scheme, bearerScheme):
+			tokens = append(tokens, presented{strings.TrimSpace(credentials), bearerScheme})
+		case strings.EqualFold(scheme, dpopScheme):
+			tokens = append(tokens, presented{strings.TrimSpace(credentials), dpopScheme})
+		}
+	}
+	if c.cookie != "" {
+		if cookie, err := r.Cookie(c.cookie); err == nil && cookie.Value != "" {
+			tokens = append(tokens, presented{cookie.Value, bearerScheme})
+		}
+	}
+	if c.query != "" {
+		if value := r.URL.Query().Get(c.query); value != "" {
+			tokens = append(tokens, presented{value, bearerScheme})
+		}
+	}
+	switch len(tokens) {
+	case 0:
+		return "", "", nil
+	case 1:
+		return tokens[0].token, tokens[0].scheme, nil
+	default:
+		return "", "", errMultipleTokens
+	}
+}
+
+var errMultipleTokens = errors.New("more than one method used to transmit the token")
+
+// writeValidationError répond au refus d'un token avec le code de StatusCode : 401 et un challenge
+// invalid_token si le token est en cause, sinon une erreur serveur sans détail.
+func writeValidationError(w http.ResponseWriter, scheme, realm string, err error) {
+	status := StatusCode(err)
+	if status != http.StatusUnauthorized {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	writeChallenge(w, scheme, realm, status, "invalid_token", err.Error(), "")
+}
+
+// writeBearerError écrit une réponse d'erreur avec l'en-tête WWW-Authenticate de la RFC 6750.
+func writeBearerError(w http.ResponseWriter, realm string, status int, code, description, scope string) {
+	writeChallenge(w, bearerScheme, realm, status, code, description, scope)
+}
+
+// writeChallenge écrit une réponse d'erreur avec un en-tête WWW-Authenticate pour le schéma donné.
+func writeChallenge(w http.ResponseWriter, scheme, realm string, status int, code, description, scope string) {
+	var params []string
+	if realm != "" {
+		params = append(params, `realm="`+quoteParam(realm)+`"`)
+	}
+	if code != "" {
+		params = append(params, `error="`+code+`"`)
+	}
+	if description != "" {
+		params = append(params, `error_description="`+quoteParam(description)+`"`)
+	}
+	if scope != "" {
+		params = append(params, `scope="`+quoteParam(scope)+`"`)
+	}
+	challenge := scheme
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// quoteParam neutralise les caractères interdits dans un paramètre entre guillemets.
+func quoteParam(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
+
+// ContextWithClaims retourne une copie du contexte portant les claims d'un token validé.
+func ContextWithClaims(ctx context.Context, claims jwt.MapClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// ClaimsFromContext retourne les claims placés dans le contexte par le middleware.
+func ClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(jwt.MapClaims)
+	return claims, ok
+}
+
+// TokenFromContext retourne le token brut authentifié par le middleware.
+func TokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(tokenContextKey).(string)
+	return token, ok
+}
+
+// TypedClaimsFromContext retourne les claims du contexte décodés dans TypedClaims[T].
+func TypedClaimsFromContext[T any](ctx context.Context) (*TypedClaims[T], error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, jwt.NewValidationError("no claims in context", jwt.ValidationErrorMalformed)
+	}
+	return decodeTypedClaims[T](claims)
+}
+
+// RequireScopes n'autorise que les requêtes dont le token porte tous les scopes donnés.
+// Il s'utilise après Middleware.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeBearerError(w, "", http.StatusUnauthorized, "", "", "")
+				return
+			}
+			granted := ScopesOf(claims)
+			for _, scope := range scopes {
+				if !slices.Contains(granted, scope) {
+					writeBearerError(w, "", http.StatusForbidden, "insufficient_scope",
+						"the token does not grant the required scope", strings.Join(scopes, " "))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoles n'autorise que les requêtes dont le token porte au moins un des rôles donnés.
+// Il s'utilise après Middleware.
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeBearerError(w, "", http.StatusUnauthorized, "", "", "")
+				return
+			}
+			for _, role := range stringsClaim(claims[rolesClaim]) {
+				if slices.Contains(roles, role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			writeBearerError(w, "", http.StatusForbidden, "insufficient_scope", "the token does not grant the required role", "")
+		})
+	}
+}
+
+// ScopesOf retourne les scopes d'un token : le claim scope (chaîne séparée par des espaces)
+// ou, à défaut, le claim scp (tableau).
+func ScopesOf(claims jwt.MapClaims) []string {
+	if scope, ok := claims[scopeClaim].(string); ok {
+		return strings.Fields(scope)
+	}
+	return stringsClaim(claims["scp"])
+}
+
+// stringsClaim convertit un claim chaîne ou tableau de chaînes en []string.
+func stringsClaim(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
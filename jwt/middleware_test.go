@@ -0,0 +1,116 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	token, err := j.GenerateToken("testData", Subject("user-42"))
+	assert.NoError(t, err)
+
+	var gotSubject, gotToken string
+	handler := j.Middleware(Realm("api"), TokenFromCookie("session"), TokenFromQuery("access_token"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			assert.True(t, ok)
+			gotSubject, _ = claims["sub"].(string)
+			gotToken, _ = TokenFromContext(r.Context())
+		}))
+
+	tests := []struct {
+		name      string
+		prepare   func(r *http.Request)
+		status    int
+		challenge string
+	}{
+		{"header", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }, http.StatusOK, ""},
+		{"lowercase scheme", func(r *http.Request) { r.Header.Set("Authorization", "bearer "+token) }, http.StatusOK, ""},
+		{"cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: token}) }, http.StatusOK, ""},
+		{"query", func(r *http.Request) { r.URL.RawQuery = "access_token=" + token }, http.StatusOK, ""},
+		{"missing", func(r *http.Request) {}, http.StatusUnauthorized, `Bearer realm="api"`},
+		{"other scheme", func(r *http.Request) { r.Header.Set("Authorization", "Basic dXNlcjpwYXNz") }, http.StatusUnauthorized, `Bearer realm="api"`},
+		{"invalid", func(r *http.Request) { r.Header.Set("Authorization", "Bearer not-a-token") }, http.StatusUnauthorized, `Bearer realm="api", error="invalid_token"`},
+		{"two methods", func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+			r.URL.RawQuery = "access_token=" + token
+		}, http.StatusBadRequest, `Bearer realm="api", error="invalid_request"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSubject, gotToken = "", ""
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.prepare(req)
+			rec := httptest.NewRecorder()
+
+			// Test
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, "user-42", gotSubject)
+				assert.Equal(t, token, gotToken)
+				return
+			}
+			assert.Contains(t, rec.Header().Get("WWW-Authenticate"), tt.challenge)
+		})
+	}
+}
+
+func TestRequireScopesAndRoles(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	reader, err := j.GenerateToken("testData", Scopes("orders:read"), Roles("support"))
+	assert.NoError(t, err)
+	writer, err := j.GenerateToken("testData", Scopes("orders:read", "orders:write"), Roles("admin"))
+	assert.NoError(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	scoped := j.Middleware()(RequireScopes("orders:read", "orders:write")(ok))
+	admin := j.Middleware()(RequireRoles("admin", "owner")(ok))
+
+	serve := func(h http.Handler, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Test & Assert
+	rec := serve(scoped, reader)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, `Bearer error="insufficient_scope", error_description="the token does not grant the required scope", scope="orders:read orders:write"`,
+		rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusOK, serve(scoped, writer).Code)
+
+	assert.Equal(t, http.StatusForbidden, serve(admin, reader).Code)
+	assert.Equal(t, http.StatusOK, serve(admin, writer).Code)
+
+	rec = httptest.NewRecorder()
+	RequireScopes("orders:read")(ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "claims are required in the context")
+}
+
+func TestTypedClaimsFromContext(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	token, err := GenerateTypedToken(j, testUser{ID: "42"})
+	assert.NoError(t, err)
+	claims, err := j.ValidateToken(token)
+	assert.NoError(t, err)
+
+	// Test
+	typed, err := TypedClaimsFromContext[testUser](ContextWithClaims(httptest.NewRequest(http.MethodGet, "/", nil).Context(), claims))
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "42", typed.Data.ID)
+}
@@ -0,0 +1,283 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Grants OAuth 2.0 pris en charge par TokenHandler.
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+	GrantAuthorizationCode = "authorization_code"
+)
+
+// oauthError est une réponse d'erreur OAuth 2.0 (RFC 6749, section 5.2).
+type oauthError struct {
+	status      int
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(status int, code, description string) *oauthError {
+	return &oauthError{status: status, Code: code, Description: description}
+}
+
+// tokenResponse est la réponse du endpoint de token (RFC 6749, section 5.1).
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// TokenHandler retourne le endpoint de token OAuth 2.0 (RFC 6749) pour les grants
+// client_credentials, authorization_code et refresh_token. Les clients s'authentifient
+// par HTTP Basic ou par les paramètres client_id et client_secret du formulaire ;
+// un client public ne transmet que son client_id.
+//
+// Le grant client_credentials émet un access token dont le sujet est le client ;
+// les scopes demandés doivent faire partie de ceux du client (tous par défaut).
+// Il est refusé aux clients publics.
+// Le grant authorization_code échange un code émis par AuthorizeHandler, avec son
+// code_verifier PKCE, contre une paire de tokens dont le sujet est l'utilisateur.
+// Le grant refresh_token échange un refresh token émis pour ce même client,
+// éventuellement pour un sous-ensemble de ses scopes.
+//
+// Une requête accompagnée d'une preuve DPoP (en-tête DPoP, RFC 9449) obtient des tokens
+// liés à la clé de la preuve, de type DPoP ; un refresh token lié exige une preuve de la même clé.
+func (j *Tools) TokenHandler(clients ClientRegistry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeOAuthError(w, newOAuthError(http.StatusMethodNotAllowed, "invalid_request", "the token endpoint only accepts POST"))
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, newOAuthError(http.StatusBadRequest, "invalid_request", "malformed form body"))
+			return
+		}
+		client, oerr := authenticateClient(r, clients)
+		if oerr != nil {
+			writeOAuthError(w, oerr)
+			return
+		}
+
+		var jkt string
+		if r.Header.Get("DPoP") != "" {
+			var err error
+			if jkt, err = j.dpopRequest(r, ""); err != nil {
+				if !errors.Is(err, ErrInvalidDPoPProof) {
+					writeOAuthError(w, newOAuthError(http.StatusInternalServerError, "server_error", ""))
+					return
+				}
+				writeOAuthError(w, newOAuthError(http.StatusBadRequest, "invalid_dpop_proof", err.Error()))
+				return
+			}
+		}
+
+		grantType := r.PostForm.Get("grant_type")
+		var resp *tokenResponse
+		switch grantType {
+		case "":
+			oerr = newOAuthError(http.StatusBadRequest, "invalid_request", "missing grant_type")
+		case GrantClientCredentials, GrantAuthorizationCode, GrantRefreshToken:
+			if !client.AllowsGrant(grantType) || (client.Public && grantType == GrantClientCredentials) {
+				oerr = newOAuthError(http.StatusBadRequest, "unauthorized_client", "the client is not allowed to use this grant")
+				break
+			}
+			switch grantType {
+			case GrantClientCredentials:
+				resp, oerr = j.clientCredentialsGrant(client, r.PostForm, jkt)
+			case GrantAuthorizationCode:
+				resp, oerr = j.authorizationCodeGrant(client, r.PostForm, jkt)
+			default:
+				resp, oerr = j.refreshTokenGrant(client, r.PostForm, jkt)
+			}
+		default:
+			oerr = newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "unsupported grant_type "+grantType)
+		}
+		if oerr != nil {
+			writeOAuthError(w, oerr)
+			return
+		}
+		writeOAuthJSON(w, http.StatusOK, resp)
+	})
+}
+
+func (j *Tools) clientCredentialsGrant(client *Client, form url.Values, jkt string) (*tokenResponse, *oauthError) {
+	scopes, oerr := grantedScopes(form.Get("scope"), client.Scopes)
+	if oerr != nil {
+		return nil, oerr
+	}
+	opts := []TokenOption{Subject(client.ID), ClientID(client.ID), withClaim(tokenUseClaim, tokenUseAccess)}
+	if len(scopes) > 0 {
+		opts = append(opts, Scopes(scopes...))
+	}
+	if jkt != "" {
+		opts = append(opts, DPoPKey(jkt))
+	}
+	accessToken, exp, err := j.generate(nil, j.newTokenConfig(opts))
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+	}
+	return &tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   tokenType(jkt),
+		ExpiresIn:   j.expiresIn(exp),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+func (j *Tools) refreshTokenGrant(client *Client, form url.Values, jkt string) (*tokenResponse, *oauthError) {
+	refreshToken := form.Get("refresh_token")
+	if refreshToken == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "missing refresh_token")
+	}
+	// Le refresh token est contrôlé avant d'être consommé, pour qu'un autre client ne puisse pas l'invalider.
+	claims, err := j.parse(refreshToken, j.newValidateConfig(nil))
+	if err != nil || claims[tokenUseClaim] != tokenUseRefresh {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+	}
+	if claims[clientIDClaim] != client.ID {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "the refresh token was issued to another client")
+	}
+	if bound := confirmationKey(claims); bound != "" && bound != jkt {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "the refresh token is bound to another DPoP key")
+	}
+	original := ScopesOf(claims)
+	var opts []TokenOption
+	if jkt != "" {
+		opts = append(opts, DPoPKey(jkt))
+	}
+	if requested := form.Get("scope"); requested != "" {
+		scopes, oerr := grantedScopes(requested, original)
+		if oerr != nil {
+			return nil, oerr
+		}
+		opts = append(opts, Scopes(scopes...))
+		original = scopes
+	}
+
+	pair, err := j.refresh(refreshToken, opts)
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		var tokenErr *TokenError
+		if errors.As(err, &validationErr) || errors.As(err, &tokenErr) || errors.Is(err, ErrRefreshTokenReused) ||
+			errors.Is(err, ErrRefreshTokenRevoked) || errors.Is(err, ErrRefreshTokenNotFound) {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", err.Error())
+		}
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+	}
+	return &tokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    tokenType(jkt),
+		ExpiresIn:    j.expiresIn(pair.AccessExpiresAt),
+		RefreshToken: pair.RefreshToken,
+		Scope:        strings.Join(original, " "),
+	}, nil
+}
+
+// tokenType retourne le token_type des tokens émis : DPoP quand ils sont liés à une clé.
+func tokenType(jkt string) string {
+	if jkt != "" {
+		return dpopScheme
+	}
+	return bearerScheme
+}
+
+// expiresIn retourne la durée de validité restante en secondes.
+func (j *Tools) expiresIn(exp time.Time) int64 {
+	return int64(exp.Sub(j.now()).Round(time.Second) / time.Second)
+}
+
+// grantedScopes retourne les scopes demandés s'ils sont tous autorisés, ou tous les scopes autorisés
+// si aucun n'est demandé.
+func grantedScopes(requested string, allowed []string) ([]string, *oauthError) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return allowed, nil
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", "scope "+scope+" is not allowed")
+		}
+	}
+	return scopes, nil
+}
+
+// authenticateClient authentifie le client par HTTP Basic (client_secret_basic)
+// ou par le formulaire (client_secret_post). Utiliser les deux méthodes est une erreur.
+// Un client public n'est qu'identifié : il n'a pas de secret.
+func authenticateClient(r *http.Request, clients ClientRegistry) (*Client, *oauthError) {
+	clientID, clientSecret, basic := r.BasicAuth()
+	if basic {
+		// Les identifiants Basic sont encodés en application/x-www-form-urlencoded (RFC 6749, section 2.3.1).
+		var errID, errSecret error
+		clientID, errID = url.QueryUnescape(clientID)
+		clientSecret, errSecret = url.QueryUnescape(clientSecret)
+		if errID != nil || errSecret != nil {
+			return nil, invalidClientError(basic)
+		}
+		if r.PostForm.Has("client_secret") {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "more than one client authentication method used")
+		}
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		if clientID != "" && clientSecret == "" {
+			// Un client public s'identifie par son seul client_id (RFC 6749, section 3.2.1).
+			if client, err := clients.Client(clientID); err == nil && client.Public {
+				return client, nil
+			}
+			return nil, invalidClientError(basic)
+		}
+	}
+	if clientID == "" {
+		return nil, invalidClientError(basic)
+	}
+	client, err := clients.Authenticate(clientID, clientSecret)
+	if err != nil {
+		return nil, invalidClientError(basic)
+	}
+	return client, nil
+}
+
+func invalidClientError(basic bool) *oauthError {
+	oerr := newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	if !basic {
+		// Sans tentative HTTP Basic, la RFC 6749 permet de répondre 400.
+		oerr.status = http.StatusBadRequest
+	}
+	return oerr
+}
+
+// writeOAuthError écrit une réponse d'erreur OAuth 2.0.
+func writeOAuthError(w http.ResponseWriter, oerr *oauthError) {
+	switch oerr.status {
+	case http.StatusUnauthorized:
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	case http.StatusMethodNotAllowed:
+		w.Header().Set("Allow", http.MethodPost)
+	}
+	writeOAuthJSON(w, oerr.status, oerr)
+}
+
+// writeOAuthJSON écrit une réponse JSON qui ne doit pas être mise en cache (RFC 6749, section 5.1).
+func writeOAuthJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,138 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/abdotop/tools/kryptonite"
+)
+
+const clientSaltSize = 16
+
+var (
+	// ErrInvalidClient est retournée quand l'authentification d'un client OAuth échoue.
+	// Un client inconnu et un secret erroné ne sont volontairement pas distingués.
+	ErrInvalidClient = errors.New("invalid client credentials")
+	// ErrClientNotFound est retournée quand un client OAuth est inconnu du registre.
+	ErrClientNotFound = errors.New("client not found")
+)
+
+// Client décrit un client OAuth 2.0 enregistré.
+type Client struct {
+	ID           string
+	SecretHash   string // empreinte kryptonite du secret, jamais le secret en clair
+	Salt         []byte
+	Scopes       []string // scopes que le client peut obtenir
+	GrantTypes   []string // grants autorisés ; vide pour tous les grants du serveur
+	RedirectURIs []string // URI de redirection acceptées pour le grant authorization_code
+	// Public désigne un client sans secret (application mobile ou SPA) : il s'identifie
+	// par son client_id et doit utiliser PKCE.
+	Public bool
+}
+
+// AllowsGrant indique si le client peut utiliser le grant donné.
+func (c *Client) AllowsGrant(grantType string) bool {
+	return len(c.GrantTypes) == 0 || slices.Contains(c.GrantTypes, grantType)
+}
+
+// ClientRegistry retrouve et authentifie les clients OAuth.
+type ClientRegistry interface {
+	// Client retourne le client sans l'authentifier, ou ErrClientNotFound.
+	Client(clientID string) (*Client, error)
+	// Authenticate vérifie le secret d'un client confidentiel, ou retourne ErrInvalidClient.
+	Authenticate(clientID, clientSecret string) (*Client, error)
+}
+
+// MemoryClientRegistry est un registre de clients en mémoire. Les secrets sont hachés avec kryptonite.
+type MemoryClientRegistry struct {
+	hasher  *kryptonite.Kryptonite
+	mu      sync.RWMutex
+	clients map[string]*Client
+	// dummy sert à comparer un secret quand le client est inconnu,
+	// pour que la durée de la réponse ne révèle pas les identifiants valides.
+	dummy *Client
+}
+
+// NewMemoryClientRegistry crée un registre dont les secrets sont hachés par hasher.
+func NewMemoryClientRegistry(hasher *kryptonite.Kryptonite) (*MemoryClientRegistry, error) {
+	r := &MemoryClientRegistry{hasher: hasher, clients: make(map[string]*Client)}
+	dummy, err := r.hash(Client{}, newID())
+	if err != nil {
+		return nil, err
+	}
+	r.dummy = dummy
+	return r, nil
+}
+
+// Register enregistre un client avec son secret, qui est haché avant d'être conservé.
+// Un client public s'enregistre sans secret.
+func (r *MemoryClientRegistry) Register(client Client, secret string) error {
+	if client.ID == "" {
+		return errors.New("client id is empty")
+	}
+	var hashed *Client
+	switch {
+	case client.Public && secret != "":
+		return errors.New("public client cannot have a secret")
+	case client.Public:
+		client.Scopes = slices.Clone(client.Scopes)
+		client.GrantTypes = slices.Clone(client.GrantTypes)
+		client.RedirectURIs = slices.Clone(client.RedirectURIs)
+		hashed = &client
+	case secret == "":
+		return errors.New("client secret is empty")
+	default:
+		var err error
+		if hashed, err = r.hash(client, secret); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[client.ID] = hashed
+	return nil
+}
+
+func (r *MemoryClientRegistry) hash(client Client, secret string) (*Client, error) {
+	client.Salt = make([]byte, clientSaltSize)
+	if _, err := rand.Read(client.Salt); err != nil {
+		return nil, err
+	}
+	hash, err := r.hasher.GenerateHash(secret, client.Salt)
+	if err != nil {
+		return nil, err
+	}
+	client.SecretHash = hash
+	client.Scopes = slices.Clone(client.Scopes)
+	client.GrantTypes = slices.Clone(client.GrantTypes)
+	client.RedirectURIs = slices.Clone(client.RedirectURIs)
+	return &client, nil
+}
+
+func (r *MemoryClientRegistry) Client(clientID string) (*Client, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	client, ok := r.clients[clientID]
+	if !ok {
+		return nil, ErrClientNotFound
+	}
+	c := *client
+	return &c, nil
+}
+
+func (r *MemoryClientRegistry) Authenticate(clientID, clientSecret string) (*Client, error) {
+	client, err := r.Client(clientID)
+	if err != nil {
+		_ = r.hasher.CompareHashAndPassword(r.dummy.SecretHash, clientSecret, r.dummy.Salt)
+		return nil, ErrInvalidClient
+	}
+	if client.Public {
+		return nil, ErrInvalidClient
+	}
+	if err := r.hasher.CompareHashAndPassword(client.SecretHash, clientSecret, client.Salt); err != nil {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
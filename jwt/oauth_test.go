@@ -0,0 +1,195 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abdotop/tools/kryptonite"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClientRegistry(t *testing.T) *MemoryClientRegistry {
+	t.Helper()
+	hasher, err := kryptonite.New("client-secret-key", sha256.New)
+	assert.NoError(t, err)
+	clients, err := NewMemoryClientRegistry(hasher)
+	assert.NoError(t, err)
+	assert.NoError(t, clients.Register(Client{ID: "billing", Scopes: []string{"orders:read", "orders:write"}}, "s3cret"))
+	assert.NoError(t, clients.Register(Client{ID: "reporting", Scopes: []string{"orders:read"}, GrantTypes: []string{GrantRefreshToken}}, "r3port"))
+	return clients
+}
+
+// postToken envoie une requête au endpoint de token et décode la réponse JSON.
+func postToken(t *testing.T, handler http.Handler, form url.Values, basicUser, basicPassword string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if basicUser != "" {
+		req.SetBasicAuth(url.QueryEscape(basicUser), url.QueryEscape(basicPassword))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	body := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return rec, body
+}
+
+func TestMemoryClientRegistry(t *testing.T) {
+	clients := newTestClientRegistry(t)
+
+	client, err := clients.Authenticate("billing", "s3cret")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders:read", "orders:write"}, client.Scopes)
+	assert.NotContains(t, client.SecretHash, "s3cret")
+
+	_, err = clients.Authenticate("billing", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+	_, err = clients.Authenticate("unknown", "s3cret")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+	_, err = clients.Client("unknown")
+	assert.ErrorIs(t, err, ErrClientNotFound)
+
+	assert.Error(t, clients.Register(Client{ID: "empty"}, ""))
+
+	// Un client public n'a pas de secret et ne peut pas s'authentifier.
+	assert.Error(t, clients.Register(Client{ID: "spa", Public: true}, "secret"))
+	assert.NoError(t, clients.Register(Client{ID: "spa", Public: true}, ""))
+	_, err = clients.Authenticate("spa", "")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+}
+
+func TestTokenHandlerClientCredentials(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	handler := j.TokenHandler(newTestClientRegistry(t))
+
+	rec, body := postToken(t, handler, url.Values{"grant_type": {"client_credentials"}}, "billing", "s3cret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "Bearer", body["token_type"])
+	assert.Equal(t, float64(3600), body["expires_in"])
+	assert.Equal(t, "orders:read orders:write", body["scope"])
+	assert.Nil(t, body["refresh_token"])
+	claims, err := j.ValidateToken(body["access_token"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, "billing", claims["sub"])
+	assert.Equal(t, "billing", claims["client_id"])
+
+	// Authentification par le formulaire et restriction des scopes.
+	rec, body = postToken(t, handler, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"billing"},
+		"client_secret": {"s3cret"},
+		"scope":         {"orders:read"},
+	}, "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "orders:read", body["scope"])
+}
+
+func TestTokenHandlerErrors(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	handler := j.TokenHandler(newTestClientRegistry(t))
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		user     string
+		password string
+		status   int
+		code     string
+	}{
+		{"wrong secret", url.Values{"grant_type": {"client_credentials"}}, "billing", "wrong", http.StatusUnauthorized, "invalid_client"},
+		{"no credentials", url.Values{"grant_type": {"client_credentials"}}, "", "", http.StatusBadRequest, "invalid_client"},
+		{"two methods", url.Values{"grant_type": {"client_credentials"}, "client_secret": {"s3cret"}}, "billing", "s3cret", http.StatusBadRequest, "invalid_request"},
+		{"missing grant", url.Values{}, "billing", "s3cret", http.StatusBadRequest, "invalid_request"},
+		{"unknown grant", url.Values{"grant_type": {"password"}}, "billing", "s3cret", http.StatusBadRequest, "unsupported_grant_type"},
+		{"grant not allowed", url.Values{"grant_type": {"client_credentials"}}, "reporting", "r3port", http.StatusBadRequest, "unauthorized_client"},
+		{"scope not allowed", url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}}, "billing", "s3cret", http.StatusBadRequest, "invalid_scope"},
+		{"missing refresh token", url.Values{"grant_type": {"refresh_token"}}, "billing", "s3cret", http.StatusBadRequest, "invalid_request"},
+		{"invalid refresh token", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"garbage"}}, "billing", "s3cret", http.StatusBadRequest, "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, body := postToken(t, handler, tt.form, tt.user, tt.password)
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.code, body["error"])
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/token", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestTokenHandlerRefreshToken(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	handler := j.TokenHandler(newTestClientRegistry(t))
+	pair, err := j.IssueTokenPair(nil, Subject("user-1"), ClientID("billing"), Scopes("orders:read", "orders:write"))
+	assert.NoError(t, err)
+
+	// Un autre client ne peut ni utiliser ni invalider le refresh token.
+	rec, body := postToken(t, handler, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {pair.RefreshToken}}, "reporting", "r3port")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_grant", body["error"])
+
+	rec, body = postToken(t, handler, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {pair.RefreshToken},
+		"scope":         {"orders:read"},
+	}, "billing", "s3cret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "orders:read", body["scope"])
+	assert.NotEmpty(t, body["refresh_token"])
+	claims, err := j.ValidateToken(body["access_token"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims["sub"])
+	assert.Equal(t, "orders:read", claims["scope"])
+
+	// Le nouveau refresh token garde le scope d'origine : le suivant peut l'obtenir à nouveau.
+	refreshClaims, err := j.parse(body["refresh_token"].(string), j.newValidateConfig(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders:read orders:write", refreshClaims["scope"])
+	rec, body = postToken(t, handler, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {body["refresh_token"].(string)},
+		"scope":         {"orders:read orders:write"},
+	}, "billing", "s3cret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "orders:read orders:write", body["scope"])
+	claims, err = j.ValidateToken(body["access_token"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders:read orders:write", claims["scope"])
+
+	// Un scope jamais accordé reste refusé.
+	rec, body = postToken(t, handler, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {body["refresh_token"].(string)},
+		"scope":         {"admin"},
+	}, "billing", "s3cret")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_scope", body["error"])
+
+	// Le refresh token d'origine a déjà été échangé.
+	rec, body = postToken(t, handler, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {pair.RefreshToken}}, "billing", "s3cret")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_grant", body["error"])
+}
+
+func TestRefreshTokenPairCarriesAuthorizationClaims(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	pair, err := j.IssueTokenPair("data", Scopes("a", "b"), Roles("admin"), ClientID("billing"))
+	assert.NoError(t, err)
+
+	refreshed, err := j.RefreshTokenPair(pair.RefreshToken)
+	assert.NoError(t, err)
+	claims, err := j.ValidateToken(refreshed.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b", claims["scope"])
+	assert.Equal(t, []interface{}{"admin"}, claims["roles"])
+	assert.Equal(t, "billing", claims["client_id"])
+}
@@ -0,0 +1,366 @@
+package jwt
+
+import (
+	"crypto"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Option configure une instance de Tools lors de sa création.
+type Option func(*Tools)
+
+// WithIssuer définit le claim iss écrit dans les tokens générés.
+func WithIssuer(issuer string) Option {
+	return func(j *Tools) {
+		j.issuer = issuer
+	}
+}
+
+// WithAudience définit le claim aud écrit dans les tokens générés.
+func WithAudience(audience ...string) Option {
+	return func(j *Tools) {
+		j.audience = audience
+	}
+}
+
+// WithExpectedIssuers restreint les émetteurs acceptés par ValidateToken.
+// Sans cette option, le claim iss n'est pas vérifié.
+func WithExpectedIssuers(issuers ...string) Option {
+	return func(j *Tools) {
+		j.expectedIssuers = issuers
+	}
+}
+
+// WithExpectedAudiences impose qu'un token vise au moins une des audiences données.
+// Sans cette option, le claim aud n'est pas vérifié.
+func WithExpectedAudiences(audiences ...string) Option {
+	return func(j *Tools) {
+		j.expectedAudiences = audiences
+	}
+}
+
+// WithLeeway tolère un décalage d'horloge lors de la vérification de exp, iat et nbf.
+func WithLeeway(leeway time.Duration) Option {
+	return func(j *Tools) {
+		j.leeway = leeway
+	}
+}
+
+// WithClock remplace l'horloge de l'instance, utilisée pour dater et valider les tokens.
+func WithClock(now func() time.Time) Option {
+	return func(j *Tools) {
+		j.now = now
+	}
+}
+
+// WithKeyRing utilise un trousseau de clés pour signer et vérifier les tokens.
+// Le kid de la clé de signature est écrit dans l'en-tête de chaque token.
+func WithKeyRing(keyRing *KeyRing) Option {
+	return func(j *Tools) {
+		j.keyRing = keyRing
+	}
+}
+
+// WithJWKSClient accepte les tokens signés par les clés publiées dans un JWKS distant.
+func WithJWKSClient(client *JWKSClient) Option {
+	return func(j *Tools) {
+		j.jwksClient = client
+	}
+}
+
+// WithRefreshTTL définit la durée de validité des refresh tokens.
+func WithRefreshTTL(ttl time.Duration) Option {
+	return func(j *Tools) {
+		j.refreshTTL = ttl
+	}
+}
+
+// WithRefreshStore définit le stockage utilisé pour suivre les refresh tokens.
+func WithRefreshStore(store RefreshStore) Option {
+	return func(j *Tools) {
+		j.refreshStore = store
+	}
+}
+
+// WithRevocationStore active la révocation des tokens : ValidateToken refuse
+// les tokens révoqués par RevokeToken, RevokeTokenID ou RevokeSubject.
+func WithRevocationStore(store RevocationStore) Option {
+	return func(j *Tools) {
+		j.revocationStore = store
+	}
+}
+
+// WithPurposeReplayCache remplace le cache en mémoire qui retient les jti consommés
+// des PurposeTokens créés sans cache, par exemple par jwt.NewGormReplayCache avec plusieurs instances.
+func WithPurposeReplayCache(cache ReplayCache) Option {
+	return func(j *Tools) {
+		j.purposeReplay = cache
+	}
+}
+
+// WithSessionStore active les sessions : StartSession enregistre chaque famille de tokens
+// avec son appareil, et ValidateToken refuse les tokens des sessions terminées.
+func WithSessionStore(store SessionStore) Option {
+	return func(j *Tools) {
+		j.sessionStore = store
+	}
+}
+
+// WithValidationCache garde en mémoire, jusqu'à leur expiration, les claims des size derniers
+// tokens dont la signature a été vérifiée : valider à nouveau un token déjà vu évite la
+// vérification cryptographique. Les autres contrôles (exp, iss, aud, révocation, sessions)
+// restent appliqués à chaque validation. Le cache est vidé quand la clé chargée change.
+func WithValidationCache(size int) Option {
+	return func(j *Tools) {
+		if size > 0 {
+			j.tokenCache = newTokenCache(size)
+		}
+	}
+}
+
+// WithTenants sert plusieurs organisations depuis une même instance : chaque token est signé
+// avec les clés d'un tenant (option Tenant) et vérifié avec celles du tenant dont l'émetteur
+// est le claim iss ; les tokens d'un émetteur inconnu sont refusés (ErrUnknownIssuer).
+// Les clés de l'instance ne sont alors plus utilisées. Seul le format JWT est pris en charge.
+func WithTenants(registry *TenantRegistry) Option {
+	return func(j *Tools) {
+		j.tenants = registry
+	}
+}
+
+// WithEncryptionKeys définit les clés des tokens chiffrés : encryptTo est la clé publique
+// RSA ou ECDSA du destinataire et decryptWith la clé privée de l'instance.
+// Sans cette option, les clés chargées par les méthodes Load* sont utilisées.
+func WithEncryptionKeys(encryptTo crypto.PublicKey, decryptWith crypto.PrivateKey) Option {
+	return func(j *Tools) {
+		j.encryptTo = encryptTo
+		j.decryptWith = decryptWith
+	}
+}
+
+// WithCodeStore définit le stockage des codes d'autorisation émis par AuthorizeHandler.
+func WithCodeStore(store CodeStore) Option {
+	return func(j *Tools) {
+		j.codeStore = store
+	}
+}
+
+// WithAuthorizationCodeTTL définit la durée de validité des codes d'autorisation (une minute par défaut).
+func WithAuthorizationCodeTTL(ttl time.Duration) Option {
+	return func(j *Tools) {
+		j.codeTTL = ttl
+	}
+}
+
+// WithDPoPReplayCache définit le cache des jti de preuves DPoP déjà présentées.
+// Un cache partagé est nécessaire quand plusieurs instances reçoivent les requêtes.
+func WithDPoPReplayCache(cache ReplayCache) Option {
+	return func(j *Tools) {
+		j.dpopReplay = cache
+	}
+}
+
+// WithDPoPProofMaxAge définit l'âge maximal d'une preuve DPoP (cinq minutes par défaut).
+func WithDPoPProofMaxAge(maxAge time.Duration) Option {
+	return func(j *Tools) {
+		j.dpopMaxAge = maxAge
+	}
+}
+
+// WithDPoPBaseURL définit l'URL publique du service (par exemple https://api.example.com),
+// utilisée pour vérifier le claim htu des preuves DPoP derrière un reverse proxy.
+func WithDPoPBaseURL(baseURL string) Option {
+	return func(j *Tools) {
+		j.dpopBaseURL = baseURL
+	}
+}
+
+// WithFormat choisit le format des tokens émis et acceptés : JWT (par défaut), PASETO v4.public
+// avec la clé Ed25519 de l'instance, ou PASETO v4.local avec les clés de WithPASETOLocalKey.
+// Une instance n'accepte que les tokens de son format.
+func WithFormat(format Format) Option {
+	return func(j *Tools) {
+		j.format = format
+	}
+}
+
+// WithPASETOLocalKey ajoute une clé symétrique de PASETOLocalKeySize octets pour les tokens
+// v4.local, identifiée par kid dans le pied du token. La dernière clé ajoutée chiffre les
+// nouveaux tokens ; les précédentes restent acceptées, ce qui permet la rotation.
+func WithPASETOLocalKey(kid string, key []byte) Option {
+	return func(j *Tools) {
+		if j.localKeys == nil {
+			j.localKeys = make(map[string][]byte)
+		}
+		j.localKeys[kid] = key
+		j.localKid = kid
+	}
+}
+
+// TokenOption personnalise un token au moment de sa génération.
+type TokenOption func(*tokenConfig)
+
+// tokenConfig regroupe les paramètres appliqués à un token lors de sa signature.
+type tokenConfig struct {
+	ttl       time.Duration
+	issuer    string
+	audience  []string
+	subject   string
+	notBefore time.Time
+	claims    jwt.MapClaims
+	tenant    string
+	err       error
+}
+
+// TTL remplace, pour un seul token, la durée de validité définie dans New.
+func TTL(ttl time.Duration) TokenOption {
+	return func(c *tokenConfig) {
+		c.ttl = ttl
+	}
+}
+
+// Subject définit le claim sub du token.
+func Subject(subject string) TokenOption {
+	return func(c *tokenConfig) {
+		c.subject = subject
+	}
+}
+
+// Audience remplace, pour un seul token, l'audience définie par WithAudience.
+func Audience(audience ...string) TokenOption {
+	return func(c *tokenConfig) {
+		c.audience = audience
+	}
+}
+
+// Issuer remplace, pour un seul token, l'émetteur défini par WithIssuer.
+func Issuer(issuer string) TokenOption {
+	return func(c *tokenConfig) {
+		c.issuer = issuer
+	}
+}
+
+// NotBefore retarde le début de validité du token (claim nbf), par défaut sa date d'émission.
+func NotBefore(notBefore time.Time) TokenOption {
+	return func(c *tokenConfig) {
+		c.notBefore = notBefore
+	}
+}
+
+// Scopes définit le claim scope du token, une liste de scopes séparés par des espaces.
+func Scopes(scopes ...string) TokenOption {
+	return withClaim(scopeClaim, strings.Join(scopes, " "))
+}
+
+// Roles définit le claim roles du token.
+func Roles(roles ...string) TokenOption {
+	return withClaim(rolesClaim, roles)
+}
+
+// ClientID définit le claim client_id : le client OAuth pour lequel le token est émis.
+func ClientID(clientID string) TokenOption {
+	return withClaim(clientIDClaim, clientID)
+}
+
+// reservedClaims sont calculés par le package ou portent l'état des refresh tokens, de DPoP
+// et des sessions : Claim ne peut pas les définir.
+var reservedClaims = []string{
+	"data", "exp", "iat", "nbf", "jti", "iss", "sub", "aud",
+	tokenUseClaim, familyClaim, cnfClaim, sessionClaim, authTimeClaim, purposeClaim,
+}
+
+// Claim ajoute un claim personnalisé au token. Les claims enregistrés (exp, sub, aud, etc.)
+// se définissent avec leurs options dédiées : les utiliser ici fait échouer la génération du token.
+func Claim(name string, value interface{}) TokenOption {
+	if slices.Contains(reservedClaims, name) {
+		return func(c *tokenConfig) {
+			if c.err == nil {
+				c.err = fmt.Errorf("claim %q is reserved", name)
+			}
+		}
+	}
+	return withClaim(name, value)
+}
+
+// newTokenConfig construit la configuration d'un token à partir des valeurs de l'instance et des options.
+func (j *Tools) newTokenConfig(opts []TokenOption) *tokenConfig {
+	cfg := &tokenConfig{
+		ttl:      j.ttl,
+		issuer:   j.issuer,
+		audience: j.audience,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// withClaim ajoute un claim au token, après les claims enregistrés.
+func withClaim(name string, value interface{}) TokenOption {
+	return func(c *tokenConfig) {
+		if c.claims == nil {
+			c.claims = jwt.MapClaims{}
+		}
+		c.claims[name] = value
+	}
+}
+
+// ValidateOption remplace, pour une seule validation, les attentes définies sur l'instance.
+type ValidateOption func(*validateConfig)
+
+// validateConfig regroupe les attentes appliquées lors de la validation d'un token.
+type validateConfig struct {
+	issuers   []string
+	audiences []string
+	leeway    time.Duration
+	dpopKey   string
+	// anyBinding accepte les tokens liés sans preuve DPoP, pour l'introspection.
+	anyBinding bool
+}
+
+// ExpectIssuers remplace la liste des émetteurs acceptés définie par WithExpectedIssuers.
+func ExpectIssuers(issuers ...string) ValidateOption {
+	return func(c *validateConfig) {
+		c.issuers = issuers
+	}
+}
+
+// ExpectAudiences remplace la liste des audiences acceptées définie par WithExpectedAudiences.
+func ExpectAudiences(audiences ...string) ValidateOption {
+	return func(c *validateConfig) {
+		c.audiences = audiences
+	}
+}
+
+// Leeway remplace la tolérance de décalage d'horloge définie par WithLeeway.
+func Leeway(leeway time.Duration) ValidateOption {
+	return func(c *validateConfig) {
+		c.leeway = leeway
+	}
+}
+
+// DPoPProofKey indique que la requête porte une preuve DPoP vérifiée (voir VerifyDPoPProof)
+// pour la clé d'empreinte jkt : seul un token lié à cette clé est alors accepté.
+// Sans cette option, les tokens liés à une clé sont refusés (ErrTokenBindingMismatch).
+func DPoPProofKey(jkt string) ValidateOption {
+	return func(c *validateConfig) {
+		c.dpopKey = jkt
+	}
+}
+
+// newValidateConfig construit les attentes d'une validation à partir des valeurs de l'instance et des options.
+func (j *Tools) newValidateConfig(opts []ValidateOption) *validateConfig {
+	cfg := &validateConfig{
+		issuers:   j.expectedIssuers,
+		audiences: j.expectedAudiences,
+		leeway:    j.leeway,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
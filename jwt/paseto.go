@@ -0,0 +1,330 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+// Format désigne le format des tokens émis et acceptés par une instance.
+type Format int
+
+const (
+	// FormatJWT produit des JWT signés (JWS), le format par défaut.
+	FormatJWT Format = iota
+	// FormatPASETOPublic produit des PASETO v4.public, signés en Ed25519.
+	FormatPASETOPublic
+	// FormatPASETOLocal produit des PASETO v4.local, chiffrés avec une clé symétrique.
+	FormatPASETOLocal
+)
+
+const (
+	pasetoPublicHeader = "v4.public."
+	pasetoLocalHeader  = "v4.local."
+	pasetoNonceSize    = 32
+	pasetoMACSize      = 32
+	// PASETOLocalKeySize est la taille des clés v4.local.
+	PASETOLocalKeySize = 32
+)
+
+// pasetoTimeClaims sont les claims de date, encodés en RFC 3339 dans un PASETO
+// et en secondes Unix dans les claims retournés, comme pour un JWT.
+var pasetoTimeClaims = []string{"exp", "iat", "nbf"}
+
+// String retourne le nom du format tel qu'accepté par ParseFormat.
+func (f Format) String() string {
+	switch f {
+	case FormatJWT:
+		return "jwt"
+	case FormatPASETOPublic:
+		return "v4.public"
+	case FormatPASETOLocal:
+		return "v4.local"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// ParseFormat convertit un nom de format issu de la configuration : jwt, v4.public ou v4.local.
+func ParseFormat(name string) (Format, error) {
+	for _, f := range []Format{FormatJWT, FormatPASETOPublic, FormatPASETOLocal} {
+		if strings.EqualFold(name, f.String()) {
+			return f, nil
+		}
+	}
+	return FormatJWT, fmt.Errorf("unknown token format %q", name)
+}
+
+// pasetoFooter est le pied de token, authentifié mais non chiffré, qui porte l'identifiant de clé.
+type pasetoFooter struct {
+	Kid string `json:"kid,omitempty"`
+}
+
+// sealPASETO produit un PASETO v4 à partir des claims, au format de l'instance.
+func (j *Tools) sealPASETO(claims jwt.MapClaims, now time.Time) (string, error) {
+	payload := jwt.MapClaims{}
+	for name, value := range claims {
+		payload[name] = value
+	}
+	for _, name := range pasetoTimeClaims {
+		if unix, ok := payload[name].(int64); ok {
+			payload[name] = time.Unix(unix, 0).UTC().Format(time.RFC3339)
+		}
+	}
+	message, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	switch j.format {
+	case FormatPASETOPublic:
+		signingKey, kid, err := j.signingKey(now)
+		if err != nil {
+			return "", err
+		}
+		privateKey, ok := signingKey.(ed25519.PrivateKey)
+		if !ok {
+			return "", errors.New("v4.public tokens require an Ed25519 key")
+		}
+		footer, err := encodePASETOFooter(kid)
+		if err != nil {
+			return "", err
+		}
+		signature := ed25519.Sign(privateKey, pae([]byte(pasetoPublicHeader), message, footer, nil))
+		return pasetoToken(pasetoPublicHeader, append(message, signature...), footer), nil
+	case FormatPASETOLocal:
+		key, ok := j.localKeys[j.localKid]
+		if !ok {
+			return "", errors.New("v4.local key not configured")
+		}
+		footer, err := encodePASETOFooter(j.localKid)
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, pasetoNonceSize)
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		body, err := pasetoEncrypt(key, nonce, message, footer)
+		if err != nil {
+			return "", err
+		}
+		return pasetoToken(pasetoLocalHeader, body, footer), nil
+	default:
+		return "", fmt.Errorf("unsupported token format %s", j.format)
+	}
+}
+
+// openPASETO vérifie ou déchiffre un PASETO v4 au format de l'instance et retourne ses claims.
+// Les claims enregistrés ne sont pas vérifiés. La clé qui a vérifié ou déchiffré le token est aussi retournée.
+func (j *Tools) openPASETO(tokenString string) (jwt.MapClaims, interface{}, error) {
+	header := pasetoPublicHeader
+	if j.format == FormatPASETOLocal {
+		header = pasetoLocalHeader
+	}
+	if !strings.HasPrefix(tokenString, header) {
+		return nil, nil, jwt.NewValidationError("token is not a "+strings.TrimSuffix(header, "."), jwt.ValidationErrorMalformed)
+	}
+	body, footer, kid, err := splitPASETO(strings.TrimPrefix(tokenString, header))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var message []byte
+	if j.format == FormatPASETOPublic {
+		if len(body) < ed25519.SignatureSize {
+			return nil, nil, jwt.NewValidationError("token is too short", jwt.ValidationErrorMalformed)
+		}
+		message, signature := body[:len(body)-ed25519.SignatureSize], body[len(body)-ed25519.SignatureSize:]
+		key, err := j.verificationKeyByID(kid)
+		if err != nil {
+			return nil, nil, err
+		}
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, nil, errors.New("v4.public tokens require an Ed25519 key")
+		}
+		if !ed25519.Verify(publicKey, pae([]byte(header), message, footer, nil), signature) {
+			return nil, nil, jwt.NewValidationError("invalid signature", jwt.ValidationErrorSignatureInvalid)
+		}
+		claims, err := decodePASETOClaims(message)
+		return claims, publicKey, err
+	}
+
+	key, ok := j.localKeys[kid]
+	if !ok {
+		return nil, nil, ErrUnknownKeyID
+	}
+	if message, err = pasetoDecrypt(key, body, footer); err != nil {
+		return nil, nil, err
+	}
+	claims, err := decodePASETOClaims(message)
+	return claims, key, err
+}
+
+// pasetoEncrypt chiffre le message selon v4.local : XChaCha20 puis BLAKE2b-MAC
+// (encrypt-then-MAC), avec des clés dérivées du nonce. Il retourne n || c || t.
+func pasetoEncrypt(key, nonce, message, footer []byte) ([]byte, error) {
+	encryptionKey, counterNonce, authKey, err := pasetoSplitKey(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(message))
+	cipher.XORKeyStream(ciphertext, message)
+	tag, err := pasetoMAC(authKey, nonce, ciphertext, footer)
+	if err != nil {
+		return nil, err
+	}
+	body := append(append(append([]byte{}, nonce...), ciphertext...), tag...)
+	return body, nil
+}
+
+// pasetoDecrypt vérifie le MAC d'un corps v4.local puis le déchiffre.
+func pasetoDecrypt(key, body, footer []byte) ([]byte, error) {
+	if len(body) < pasetoNonceSize+pasetoMACSize {
+		return nil, jwt.NewValidationError("token is too short", jwt.ValidationErrorMalformed)
+	}
+	nonce := body[:pasetoNonceSize]
+	ciphertext := body[pasetoNonceSize : len(body)-pasetoMACSize]
+	tag := body[len(body)-pasetoMACSize:]
+
+	encryptionKey, counterNonce, authKey, err := pasetoSplitKey(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := pasetoMAC(authKey, nonce, ciphertext, footer)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(tag, expected) {
+		return nil, jwt.NewValidationError("invalid authentication tag", jwt.ValidationErrorSignatureInvalid)
+	}
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return nil, err
+	}
+	message := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(message, ciphertext)
+	return message, nil
+}
+
+// pasetoSplitKey dérive la clé de chiffrement, le nonce XChaCha20 et la clé d'authentification
+// d'un token v4.local à partir de la clé et du nonce du token.
+func pasetoSplitKey(key, nonce []byte) (encryptionKey, counterNonce, authKey []byte, err error) {
+	if len(key) != PASETOLocalKeySize {
+		return nil, nil, nil, fmt.Errorf("v4.local key must be %d bytes", PASETOLocalKeySize)
+	}
+	tmp, err := blake2bSum(key, 56, []byte("paseto-encryption-key"), nonce)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	authKey, err = blake2bSum(key, 32, []byte("paseto-auth-key-for-aead"), nonce)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return tmp[:32], tmp[32:], authKey, nil
+}
+
+func pasetoMAC(authKey, nonce, ciphertext, footer []byte) ([]byte, error) {
+	return blake2bSum(authKey, pasetoMACSize, pae([]byte(pasetoLocalHeader), nonce, ciphertext, footer, nil))
+}
+
+// blake2bSum calcule un BLAKE2b à clé de size octets sur la concaténation des parts.
+func blake2bSum(key []byte, size int, parts ...[]byte) ([]byte, error) {
+	h, err := blake2b.New(size, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return h.Sum(nil), nil
+}
+
+// pae implémente le Pre-Authentication Encoding de PASETO : le nombre de pièces puis
+// chaque pièce précédée de sa longueur, en entiers 64 bits little-endian.
+func pae(pieces ...[]byte) []byte {
+	var buf bytes.Buffer
+	le64 := func(n int) {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(n)&(1<<63-1))
+		buf.Write(b[:])
+	}
+	le64(len(pieces))
+	for _, piece := range pieces {
+		le64(len(piece))
+		buf.Write(piece)
+	}
+	return buf.Bytes()
+}
+
+func pasetoToken(header string, body, footer []byte) string {
+	token := header + base64.RawURLEncoding.EncodeToString(body)
+	if len(footer) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+	return token
+}
+
+// splitPASETO décode le corps et le pied d'un token, puis le kid du pied.
+func splitPASETO(rest string) (body, footer []byte, kid string, err error) {
+	encodedBody, encodedFooter, hasFooter := strings.Cut(rest, ".")
+	if body, err = base64.RawURLEncoding.DecodeString(encodedBody); err != nil {
+		return nil, nil, "", jwt.NewValidationError("malformed token body", jwt.ValidationErrorMalformed)
+	}
+	if !hasFooter {
+		return body, nil, "", nil
+	}
+	if footer, err = base64.RawURLEncoding.DecodeString(encodedFooter); err != nil {
+		return nil, nil, "", jwt.NewValidationError("malformed token footer", jwt.ValidationErrorMalformed)
+	}
+	var decoded pasetoFooter
+	if err := json.Unmarshal(footer, &decoded); err != nil {
+		return nil, nil, "", jwt.NewValidationError("malformed token footer", jwt.ValidationErrorMalformed)
+	}
+	return body, footer, decoded.Kid, nil
+}
+
+func encodePASETOFooter(kid string) ([]byte, error) {
+	if kid == "" {
+		return nil, nil
+	}
+	return json.Marshal(pasetoFooter{Kid: kid})
+}
+
+// decodePASETOClaims décode les claims d'un token et convertit ses dates RFC 3339 en secondes Unix.
+func decodePASETOClaims(message []byte) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(message, &claims); err != nil {
+		return nil, jwt.NewValidationError("malformed claims", jwt.ValidationErrorMalformed)
+	}
+	for _, name := range pasetoTimeClaims {
+		value, ok := claims[name]
+		if !ok {
+			continue
+		}
+		s, _ := value.(string)
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, jwt.NewValidationError("malformed "+name+" claim", jwt.ValidationErrorClaimsInvalid)
+		}
+		claims[name] = float64(t.Unix())
+	}
+	return claims, nil
+}
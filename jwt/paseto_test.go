@@ -0,0 +1,165 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPASETOLocalKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, PASETOLocalKeySize)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+	return key
+}
+
+func TestPAE(t *testing.T) {
+	// Exemples de la spécification PASETO.
+	assert.Equal(t, []byte("\x00\x00\x00\x00\x00\x00\x00\x00"), pae())
+	assert.Equal(t, []byte("\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), pae([]byte{}))
+	assert.Equal(t, []byte("\x01\x00\x00\x00\x00\x00\x00\x00\x04\x00\x00\x00\x00\x00\x00\x00test"), pae([]byte("test")))
+}
+
+func TestPASETOLocalVector(t *testing.T) {
+	// Vecteur de test 4-E-1 de la spécification PASETO v4.
+	key, _ := hex.DecodeString("707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	message := []byte(`{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`)
+	body, err := pasetoEncrypt(key, make([]byte, pasetoNonceSize), message, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg",
+		pasetoToken(pasetoLocalHeader, body, nil))
+
+	decrypted, err := pasetoDecrypt(key, body, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, message, decrypted)
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, f := range []Format{FormatJWT, FormatPASETOPublic, FormatPASETOLocal} {
+		parsed, err := ParseFormat(f.String())
+		assert.NoError(t, err)
+		assert.Equal(t, f, parsed)
+	}
+	_, err := ParseFormat("v2.local")
+	assert.Error(t, err)
+}
+
+func TestPASETOPublic(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	j := New(time.Hour, WithFormat(FormatPASETOPublic), WithIssuer("auth"))
+	j.OnError(func(error) {})
+	j.privateKey, j.publicKey = privateKey, publicKey
+
+	token, err := j.GenerateToken("data", Subject("user-1"), Scopes("orders:read"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "v4.public."))
+	_, footer, kid, err := splitPASETO(strings.TrimPrefix(token, pasetoPublicHeader))
+	assert.NoError(t, err)
+	assert.Equal(t, legacyKeyID(publicKey), kid)
+	assert.Contains(t, string(footer), `"kid"`)
+
+	claims, err := j.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims["sub"])
+	assert.Equal(t, "auth", claims["iss"])
+	assert.Equal(t, "data", claims["data"])
+	assert.IsType(t, float64(0), claims["exp"])
+
+	// Le corps et le pied sont authentifiés.
+	tampered := strings.Replace(token, "v4.public.e", "v4.public.f", 1)
+	_, err = j.ValidateToken(tampered)
+	assert.Error(t, err)
+	body, _, _ := strings.Cut(strings.TrimPrefix(token, pasetoPublicHeader), ".")
+	_, err = j.ValidateToken(pasetoToken(pasetoPublicHeader, mustDecode(t, body), []byte(`{"kid":"other"}`)))
+	assert.Error(t, err)
+
+	// Une instance PASETO n'accepte pas de JWT, et réciproquement.
+	jwtTools := New(time.Hour)
+	jwtTools.OnError(func(error) {})
+	jwtTools.privateKey, jwtTools.publicKey = privateKey, publicKey
+	jwtToken, err := jwtTools.GenerateToken("data")
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(jwtToken)
+	assert.Error(t, err)
+	_, err = jwtTools.ValidateToken(token)
+	assert.Error(t, err)
+
+	// v4.public impose Ed25519.
+	rsaTools := newTestTools(t, time.Hour)
+	rsaTools.format = FormatPASETOPublic
+	_, err = rsaTools.GenerateToken("data")
+	assert.Error(t, err)
+}
+
+func TestPASETOLocal(t *testing.T) {
+	oldKey, newKey := newPASETOLocalKey(t), newPASETOLocalKey(t)
+	previous := New(time.Hour, WithFormat(FormatPASETOLocal), WithPASETOLocalKey("k1", oldKey))
+	previous.OnError(func(error) {})
+	j := New(time.Hour, WithFormat(FormatPASETOLocal), WithPASETOLocalKey("k1", oldKey), WithPASETOLocalKey("k2", newKey))
+	j.OnError(func(error) {})
+
+	token, err := j.GenerateToken(map[string]string{"phone": "+221770000000"}, Subject("user-1"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "v4.local."))
+	assert.NotContains(t, token, "user-1")
+	claims, err := j.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims["sub"])
+
+	// Les tokens chiffrés avec une clé précédente restent acceptés ; une clé inconnue est refusée.
+	old, err := previous.GenerateToken("data")
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(old)
+	assert.NoError(t, err)
+	_, err = previous.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+
+	raw := []byte(token)
+	raw[len(pasetoLocalHeader)+50] ^= 1
+	_, err = j.ValidateToken(string(raw))
+	assert.Error(t, err)
+
+	// Les claims enregistrés sont vérifiés comme pour un JWT.
+	j.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = j.ValidateToken(token)
+	assert.Error(t, err)
+
+	noKey := New(time.Hour, WithFormat(FormatPASETOLocal))
+	noKey.OnError(func(error) {})
+	_, err = noKey.GenerateToken("data")
+	assert.Error(t, err)
+	shortKey := New(time.Hour, WithFormat(FormatPASETOLocal), WithPASETOLocalKey("k", []byte("short")))
+	shortKey.OnError(func(error) {})
+	_, err = shortKey.GenerateToken("data")
+	assert.Error(t, err)
+}
+
+func TestPASETOTokenPair(t *testing.T) {
+	j := New(time.Hour, WithFormat(FormatPASETOLocal), WithPASETOLocalKey("k1", newPASETOLocalKey(t)))
+	j.OnError(func(error) {})
+
+	pair, err := j.IssueTokenPair("data", Subject("user-1"))
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(pair.RefreshToken)
+	assert.Error(t, err)
+	rotated, err := j.RefreshTokenPair(pair.RefreshToken)
+	assert.NoError(t, err)
+	claims, err := j.ValidateToken(rotated.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims["sub"])
+}
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	body, _, _, err := splitPASETO(s)
+	assert.NoError(t, err)
+	return bytes.Clone(body)
+}
@@ -0,0 +1,105 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	tokenUsePurpose = "purpose"
+	purposeClaim    = "purpose"
+
+	defaultPurposeTTL = 15 * time.Minute
+)
+
+var (
+	// ErrTokenAlreadyUsed est retournée quand un token à usage unique est présenté une seconde fois.
+	ErrTokenAlreadyUsed = errors.New("token already used")
+	// ErrWrongPurpose est retournée quand un token est présenté pour un autre usage que celui de son émission.
+	ErrWrongPurpose = errors.New("token issued for another purpose")
+)
+
+// PurposeTokens émet et consomme des tokens à usage unique liés à un usage précis :
+// lien magique, vérification d'e-mail, réinitialisation de mot de passe, etc.
+// Ces tokens sont refusés par ValidateToken et ne peuvent donc pas servir d'access token.
+type PurposeTokens struct {
+	j    *Tools
+	ttl  time.Duration
+	used ReplayCache
+}
+
+// PurposeTokens retourne l'émetteur de tokens à usage unique de l'instance. Les tokens sont
+// valides pendant ttl (15 minutes si ttl est nul) ; used retient les jti consommés.
+// S'il est nil, le cache de l'instance est utilisé (voir WithPurposeReplayCache) : il est partagé
+// par tous les PurposeTokens de l'instance, qui peuvent donc être créés à chaque requête.
+func (j *Tools) PurposeTokens(ttl time.Duration, used ReplayCache) *PurposeTokens {
+	if ttl == 0 {
+		ttl = defaultPurposeTTL
+	}
+	if used == nil {
+		used = j.purposeReplay
+	}
+	return &PurposeTokens{j: j, ttl: ttl, used: used}
+}
+
+// Issue émet un token pour l'usage purpose et le sujet subject.
+// Les options s'appliquent au token, par exemple pour y ajouter des claims.
+func (p *PurposeTokens) Issue(purpose, subject string, opts ...TokenOption) (string, error) {
+	tokenString, err := p.issue(purpose, subject, opts)
+	if err != nil {
+		p.j.errChan <- err
+		return "", err
+	}
+	return tokenString, nil
+}
+
+func (p *PurposeTokens) issue(purpose, subject string, opts []TokenOption) (string, error) {
+	if purpose == "" || subject == "" {
+		return "", errors.New("purpose and subject are required")
+	}
+	cfg := p.j.newTokenConfig(append(append([]TokenOption{TTL(p.ttl)}, opts...),
+		Subject(subject),
+		withClaim(tokenUseClaim, tokenUsePurpose),
+		withClaim(purposeClaim, purpose),
+	))
+	tokenString, _, err := p.j.generate(nil, cfg)
+	return tokenString, err
+}
+
+// Consume vérifie un token émis pour l'usage purpose et le marque comme utilisé.
+// Un token déjà consommé est refusé avec ErrTokenAlreadyUsed.
+func (p *PurposeTokens) Consume(purpose, tokenString string) (jwt.MapClaims, error) {
+	claims, err := p.consume(purpose, tokenString)
+	if err != nil {
+		p.j.errChan <- err
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (p *PurposeTokens) consume(purpose, tokenString string) (jwt.MapClaims, error) {
+	claims, err := p.j.parse(tokenString, p.j.newValidateConfig(nil))
+	if err != nil {
+		return nil, err
+	}
+	if claims[tokenUseClaim] != tokenUsePurpose || claims[purposeClaim] != purpose {
+		return nil, ErrWrongPurpose
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, jwt.NewValidationError("token has no jti", jwt.ValidationErrorClaimsInvalid)
+	}
+	expiresAt := p.j.now().Add(p.ttl)
+	if exp, ok := claims["exp"].(float64); ok {
+		expiresAt = time.Unix(int64(exp), 0)
+	}
+	if err := p.used.Use(jti, expiresAt); err != nil {
+		if errors.Is(err, ErrReplayDetected) {
+			return nil, ErrTokenAlreadyUsed
+		}
+		return nil, err
+	}
+	return claims, nil
+}
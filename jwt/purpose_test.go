@@ -0,0 +1,88 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPurposeTokens(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	tokens := j.PurposeTokens(0, nil)
+
+	reset, err := tokens.Issue("password-reset", "user-1")
+	assert.NoError(t, err)
+	claims := unverifiedClaims(t, reset)
+	assert.InDelta(t, time.Now().Add(defaultPurposeTTL).Unix(), claims["exp"], 5)
+
+	// Un token de réinitialisation n'est ni un access token, ni valable pour un autre usage.
+	_, err = j.ValidateToken(reset)
+	assert.Error(t, err)
+	_, err = tokens.Consume("email-verification", reset)
+	assert.ErrorIs(t, err, ErrWrongPurpose)
+
+	claims, err = tokens.Consume("password-reset", reset)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims["sub"])
+
+	_, err = tokens.Consume("password-reset", reset)
+	assert.ErrorIs(t, err, ErrTokenAlreadyUsed)
+
+	// Un access token ne peut pas être consommé comme token à usage unique.
+	access, err := j.GenerateToken("data", Subject("user-1"))
+	assert.NoError(t, err)
+	_, err = tokens.Consume("password-reset", access)
+	assert.ErrorIs(t, err, ErrWrongPurpose)
+
+	_, err = tokens.Issue("", "user-1")
+	assert.Error(t, err)
+}
+
+func TestPurposeTokensExpire(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	tokens := j.PurposeTokens(time.Minute, nil)
+	link, err := tokens.Issue("magic-link", "user-1")
+	assert.NoError(t, err)
+
+	j.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = tokens.Consume("magic-link", link)
+	assert.Error(t, err)
+}
+
+func TestPurposeTokensGormReplayCache(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	assert.NoError(t, err)
+	operator := dbcrudops.New(db)
+	operator.OnError(func(error) {})
+	cache, err := NewGormReplayCache(operator)
+	assert.NoError(t, err)
+
+	// Deux instances partageant la base refusent le même token.
+	j := newTestTools(t, time.Hour)
+	first, second := j.PurposeTokens(0, cache), j.PurposeTokens(0, cache)
+	token, err := first.Issue("email-verification", "user-1")
+	assert.NoError(t, err)
+	_, err = first.Consume("email-verification", token)
+	assert.NoError(t, err)
+	_, err = second.Consume("email-verification", token)
+	assert.ErrorIs(t, err, ErrTokenAlreadyUsed)
+
+	// Les jti expirés sont purgés.
+	assert.NoError(t, cache.Use("old", time.Now().Add(-time.Minute)))
+	assert.NoError(t, cache.Use("old", time.Now().Add(time.Minute)))
+}
+
+func TestPurposeTokensShareInstanceCache(t *testing.T) {
+	// Un handler qui crée ses PurposeTokens à chaque requête applique quand même l'usage unique.
+	j := newTestTools(t, time.Hour)
+	link, err := j.PurposeTokens(0, nil).Issue("magic-link", "user-1")
+	assert.NoError(t, err)
+	_, err = j.PurposeTokens(0, nil).Consume("magic-link", link)
+	assert.NoError(t, err)
+	_, err = j.PurposeTokens(0, nil).Consume("magic-link", link)
+	assert.ErrorIs(t, err, ErrTokenAlreadyUsed)
+}
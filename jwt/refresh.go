@@ -0,0 +1,207 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	defaultRefreshTTL = 30 * 24 * time.Hour
+
+	tokenUseClaim   = "token_use"
+	tokenUseAccess  = "access"
+	tokenUseRefresh = "refresh"
+	familyClaim     = "fam"
+)
+
+// carriedClaims sont recopiés de l'access token dans le refresh token,
+// puis du refresh token dans les tokens renouvelés.
+var carriedClaims = []string{scopeClaim, rolesClaim, clientIDClaim, cnfClaim, sessionClaim}
+
+var (
+	// ErrRefreshTokenReused est retournée lorsqu'un refresh token déjà échangé est présenté à nouveau.
+	// Toute la famille de tokens est alors invalidée.
+	ErrRefreshTokenReused = errors.New("refresh token already used")
+	// ErrRefreshTokenRevoked est retournée lorsque la famille du refresh token a été invalidée.
+	ErrRefreshTokenRevoked = errors.New("refresh token revoked")
+	// ErrRefreshTokenNotFound est retournée lorsque le refresh token est inconnu du stockage.
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+)
+
+// TokenPair contient un access token et le refresh token permettant de le renouveler.
+type TokenPair struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	Family           string
+}
+
+// IssueTokenPair génère un access token et un refresh token rattachés à une nouvelle famille.
+// Les options s'appliquent à l'access token.
+func (j *Tools) IssueTokenPair(data interface{}, opts ...TokenOption) (*TokenPair, error) {
+	pair, err := j.issuePair(data, newID(), opts, nil)
+	if err != nil {
+		j.errChan <- err
+		return nil, err
+	}
+	return pair, nil
+}
+
+// RefreshTokenPair échange un refresh token contre une nouvelle paire de la même famille.
+// Un refresh token ne peut être échangé qu'une fois : sa réutilisation invalide toute la famille.
+func (j *Tools) RefreshTokenPair(refreshToken string, opts ...TokenOption) (*TokenPair, error) {
+	pair, err := j.refresh(refreshToken, opts)
+	if err != nil {
+		j.errChan <- err
+		return nil, err
+	}
+	return pair, nil
+}
+
+// RevokeTokenFamily invalide tous les refresh tokens d'une famille.
+func (j *Tools) RevokeTokenFamily(family string) error {
+	if err := j.refreshStore.RevokeFamily(family); err != nil {
+		j.errChan <- err
+		return err
+	}
+	return nil
+}
+
+func (j *Tools) refresh(refreshToken string, opts []TokenOption) (*TokenPair, error) {
+	claims, err := j.parse(refreshToken, j.newValidateConfig(nil))
+	if err != nil {
+		return nil, err
+	}
+	if claims[tokenUseClaim] != tokenUseRefresh {
+		return nil, jwt.NewValidationError("token is not a refresh token", jwt.ValidationErrorClaimsInvalid)
+	}
+	jti, _ := claims["jti"].(string)
+	family, _ := claims[familyClaim].(string)
+	if jti == "" || family == "" {
+		return nil, jwt.NewValidationError("refresh token is missing jti or family", jwt.ValidationErrorClaimsInvalid)
+	}
+
+	sid := SessionIDOf(claims)
+	if sid != "" && j.sessionStore != nil {
+		if err := j.sessionStore.Touch(sid, j.now()); err != nil {
+			return nil, err
+		}
+	}
+	// Les options de l'appel passent après les valeurs d'origine et peuvent donc les remplacer.
+	var carried []TokenOption
+	if subject, _ := claims["sub"].(string); subject != "" {
+		carried = append(carried, Subject(subject))
+	}
+	// Avec WithTenants, l'émetteur désigne le tenant qui signe la nouvelle paire.
+	if issuer, _ := claims["iss"].(string); issuer != "" && j.tenants != nil {
+		carried = append(carried, Issuer(issuer))
+	}
+	for _, name := range carriedClaims {
+		if value, ok := claims[name]; ok {
+			carried = append(carried, withClaim(name, value))
+		}
+	}
+	// Le nouveau refresh token garde la portée accordée à l'origine (RFC 6749, section 6) :
+	// une portée restreinte par l'appel ne vaut que pour l'access token.
+	kept := jwt.MapClaims{scopeClaim: claims[scopeClaim]}
+	pair, record, err := j.signPair(claims["data"], family, append(carried, opts...), kept)
+	if err != nil {
+		return nil, err
+	}
+
+	// La nouvelle paire est signée avant que l'ancien token ne soit consommé : un échec de
+	// signature ou d'enregistrement le laisse utilisable, et un nouvel essai n'est pas pris pour un rejeu.
+	if err := j.refreshStore.Rotate(jti, record); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			if revokeErr := j.refreshStore.RevokeFamily(family); revokeErr != nil {
+				return nil, revokeErr
+			}
+			// Le rejeu révèle un vol de token : la session est terminée.
+			if sid != "" && j.sessionStore != nil {
+				if terminateErr := j.sessionStore.Terminate(sid); terminateErr != nil {
+					return nil, terminateErr
+				}
+			}
+		}
+		return nil, err
+	}
+	return pair, nil
+}
+
+// issuePair génère une paire de tokens de la famille donnée et enregistre son refresh token.
+func (j *Tools) issuePair(data interface{}, family string, opts []TokenOption, kept jwt.MapClaims) (*TokenPair, error) {
+	pair, record, err := j.signPair(data, family, opts, kept)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.refreshStore.Save(record); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// signPair signe une paire de tokens de la famille donnée et retourne l'enregistrement de son
+// refresh token, à la charge de l'appelant. Les options s'appliquent à l'access token, dont le
+// refresh token reprend les claims d'autorisation, sauf ceux de kept, qui les remplacent
+// (une valeur nulle retire le claim).
+func (j *Tools) signPair(data interface{}, family string, opts []TokenOption, kept jwt.MapClaims) (*TokenPair, *RefreshRecord, error) {
+	accessCfg := j.newTokenConfig(append(append([]TokenOption{}, opts...),
+		withClaim(tokenUseClaim, tokenUseAccess),
+		withClaim(familyClaim, family),
+	))
+	accessToken, accessExp, err := j.generate(data, accessCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Le refresh token reprend l'émetteur, l'audience, le sujet et les claims
+	// d'autorisation de l'access token.
+	jti := newID()
+	refreshCfg := &tokenConfig{
+		ttl:      j.refreshTTL,
+		issuer:   accessCfg.issuer,
+		audience: accessCfg.audience,
+		subject:  accessCfg.subject,
+		claims: jwt.MapClaims{
+			tokenUseClaim: tokenUseRefresh,
+			familyClaim:   family,
+			"jti":         jti,
+		},
+	}
+	for _, name := range carriedClaims {
+		value, ok := accessCfg.claims[name]
+		if keptValue, isKept := kept[name]; isKept {
+			value, ok = keptValue, keptValue != nil
+		}
+		if ok {
+			refreshCfg.claims[name] = value
+		}
+	}
+	refreshToken, refreshExp, err := j.generate(data, refreshCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pair := &TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExp,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExp,
+		Family:           family,
+	}
+	return pair, &RefreshRecord{ID: jti, Family: family, ExpiresAt: refreshExp}, nil
+}
+
+// newID génère un identifiant aléatoire de 128 bits encodé en hexadécimal.
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
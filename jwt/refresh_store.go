@@ -0,0 +1,137 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+	"gorm.io/gorm"
+)
+
+// RefreshStore conserve l'état des refresh tokens émis.
+type RefreshStore interface {
+	// Save enregistre un refresh token nouvellement émis.
+	Save(record *RefreshRecord) error
+	// Rotate marque un refresh token comme échangé et enregistre celui qui le remplace, en une seule
+	// opération : si l'une échoue, l'autre n'a pas lieu. Elle retourne ErrRefreshTokenReused si le
+	// token était déjà échangé et ErrRefreshTokenRevoked si sa famille a été invalidée.
+	Rotate(id string, next *RefreshRecord) error
+	// RevokeFamily invalide tous les refresh tokens d'une famille.
+	RevokeFamily(family string) error
+}
+
+// RefreshRecord décrit un refresh token émis.
+type RefreshRecord struct {
+	ID        string `gorm:"primaryKey"`
+	Family    string `gorm:"index"`
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+}
+
+// MemoryRefreshStore est un RefreshStore en mémoire, adapté aux tests et aux instances uniques.
+type MemoryRefreshStore struct {
+	mu      sync.Mutex
+	records map[string]*RefreshRecord
+	sweeper memorySweeper
+	now     func() time.Time
+}
+
+// NewMemoryRefreshStore crée un RefreshStore en mémoire.
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{
+		records: make(map[string]*RefreshRecord),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryRefreshStore) Save(record *RefreshRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := s.now(); s.sweeper.due(now) {
+		sweepExpired(s.records, now, func(r *RefreshRecord) time.Time { return r.ExpiresAt })
+	}
+	saved := *record
+	s.records[record.ID] = &saved
+	return nil
+}
+
+func (s *MemoryRefreshStore) Rotate(id string, next *RefreshRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[id]
+	if !ok {
+		return ErrRefreshTokenNotFound
+	}
+	if r.Revoked {
+		return ErrRefreshTokenRevoked
+	}
+	if r.Used {
+		return ErrRefreshTokenReused
+	}
+	r.Used = true
+	saved := *next
+	s.records[next.ID] = &saved
+	return nil
+}
+
+func (s *MemoryRefreshStore) RevokeFamily(family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.records {
+		if r.Family == family {
+			r.Revoked = true
+		}
+	}
+	return nil
+}
+
+// GormRefreshStore est un RefreshStore persistant construit sur dbcrudops.
+type GormRefreshStore struct {
+	operator *dbcrudops.Operator
+}
+
+// NewGormRefreshStore crée un GormRefreshStore et migre la table des refresh tokens.
+func NewGormRefreshStore(operator *dbcrudops.Operator) (*GormRefreshStore, error) {
+	if err := operator.Migrate(&RefreshRecord{}); err != nil {
+		return nil, err
+	}
+	return &GormRefreshStore{operator: operator}, nil
+}
+
+func (s *GormRefreshStore) Save(record *RefreshRecord) error {
+	return s.operator.Create(record)
+}
+
+func (s *GormRefreshStore) Rotate(id string, next *RefreshRecord) error {
+	return s.operator.GetDb().Transaction(func(tx *gorm.DB) error {
+		// La mise à jour conditionnelle garantit qu'un seul appel concurrent peut échanger le token.
+		result := tx.Model(&RefreshRecord{}).
+			Where("id = ? AND used = ? AND revoked = ?", id, false, false).
+			Update("used", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var record RefreshRecord
+			found := tx.Where("id = ?", id).Limit(1).Find(&record)
+			if found.Error != nil {
+				return found.Error
+			}
+			if found.RowsAffected == 0 {
+				return ErrRefreshTokenNotFound
+			}
+			if record.Revoked {
+				return ErrRefreshTokenRevoked
+			}
+			return ErrRefreshTokenReused
+		}
+		return tx.Create(next).Error
+	})
+}
+
+func (s *GormRefreshStore) RevokeFamily(family string) error {
+	return s.operator.GetDb().Model(&RefreshRecord{}).
+		Where("family = ?", family).
+		Update("revoked", true).Error
+}
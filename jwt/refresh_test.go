@@ -0,0 +1,138 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestIssueTokenPair(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+
+	// Test
+	pair, err := j.IssueTokenPair("testData", TTL(time.Minute))
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pair.Family)
+	assert.True(t, pair.RefreshExpiresAt.After(pair.AccessExpiresAt))
+
+	claims, err := j.ValidateToken(pair.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "testData", claims["data"])
+	assert.Equal(t, pair.Family, claims["fam"])
+
+	_, err = j.ValidateToken(pair.RefreshToken)
+	assert.Error(t, err, "a refresh token must not be accepted as an access token")
+}
+
+func TestRefreshTokenPairRotation(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	pair, err := j.IssueTokenPair(map[string]interface{}{"id": "42"})
+	assert.NoError(t, err)
+
+	// Test
+	rotated, err := j.RefreshTokenPair(pair.RefreshToken)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, pair.Family, rotated.Family)
+	assert.NotEqual(t, pair.RefreshToken, rotated.RefreshToken)
+	claims, err := j.ValidateToken(rotated.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": "42"}, claims["data"])
+
+	_, err = j.RefreshTokenPair(pair.AccessToken)
+	assert.Error(t, err, "an access token must not be exchanged")
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	testRefreshTokenReuse(t, NewMemoryRefreshStore())
+}
+
+func TestGormRefreshStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	assert.NoError(t, err)
+	operator := dbcrudops.New(db)
+	operator.OnError(func(error) {})
+
+	store, err := NewGormRefreshStore(operator)
+	assert.NoError(t, err)
+
+	err = store.Rotate("unknown", &RefreshRecord{ID: "next", Family: "f"})
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	// Si le remplaçant ne peut être enregistré, le token n'est pas consommé.
+	expiresAt := time.Now().Add(time.Hour)
+	assert.NoError(t, store.Save(&RefreshRecord{ID: "a", Family: "f", ExpiresAt: expiresAt}))
+	assert.NoError(t, store.Save(&RefreshRecord{ID: "b", Family: "f", ExpiresAt: expiresAt}))
+	assert.Error(t, store.Rotate("a", &RefreshRecord{ID: "b", Family: "f", ExpiresAt: expiresAt}))
+	assert.NoError(t, store.Rotate("a", &RefreshRecord{ID: "c", Family: "f", ExpiresAt: expiresAt}))
+
+	testRefreshTokenReuse(t, store)
+}
+
+func testRefreshTokenReuse(t *testing.T, store RefreshStore) {
+	t.Helper()
+	j := newTestTools(t, time.Hour)
+	j.refreshStore = store
+
+	pair, err := j.IssueTokenPair("testData")
+	assert.NoError(t, err)
+	rotated, err := j.RefreshTokenPair(pair.RefreshToken)
+	assert.NoError(t, err)
+
+	// Replaying the first refresh token invalidates the whole family.
+	_, err = j.RefreshTokenPair(pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	_, err = j.RefreshTokenPair(rotated.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenRevoked)
+
+	// Other families are unaffected.
+	other, err := j.IssueTokenPair("testData")
+	assert.NoError(t, err)
+	_, err = j.RefreshTokenPair(other.RefreshToken)
+	assert.NoError(t, err)
+}
+
+// failingRefreshStore simule une panne passagère du stockage lors de l'échange d'un refresh token.
+type failingRefreshStore struct {
+	*MemoryRefreshStore
+	fail bool
+}
+
+func (s *failingRefreshStore) Rotate(id string, next *RefreshRecord) error {
+	if s.fail {
+		return errors.New("store unavailable")
+	}
+	return s.MemoryRefreshStore.Rotate(id, next)
+}
+
+func TestRefreshTokenPairRetryAfterStoreFailure(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	store := &failingRefreshStore{MemoryRefreshStore: NewMemoryRefreshStore()}
+	j.refreshStore = store
+	pair, err := j.IssueTokenPair("testData")
+	assert.NoError(t, err)
+
+	// Test
+	store.fail = true
+	_, err = j.RefreshTokenPair(pair.RefreshToken)
+	assert.Error(t, err)
+	store.fail = false
+	rotated, err := j.RefreshTokenPair(pair.RefreshToken)
+
+	// Assert
+	assert.NoError(t, err, "a failed refresh must not burn the refresh token")
+	_, err = j.RefreshTokenPair(rotated.RefreshToken)
+	assert.NoError(t, err)
+}
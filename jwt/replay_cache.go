@@ -0,0 +1,88 @@
+package jwt
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+	"gorm.io/gorm/clause"
+)
+
+// ErrReplayDetected est retournée par un ReplayCache quand un jti a déjà été utilisé.
+var ErrReplayDetected = errors.New("jti already used")
+
+// ReplayCache retient les jti déjà présentés pour détecter leur rejeu.
+type ReplayCache interface {
+	// Use enregistre jti jusqu'à expiresAt. Elle retourne ErrReplayDetected s'il est déjà enregistré.
+	Use(jti string, expiresAt time.Time) error
+}
+
+// MemoryReplayCache est un ReplayCache en mémoire, adapté aux tests et aux instances uniques.
+type MemoryReplayCache struct {
+	mu      sync.Mutex
+	jtis    map[string]time.Time
+	sweeper memorySweeper
+	now     func() time.Time
+}
+
+// NewMemoryReplayCache crée un ReplayCache en mémoire.
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{
+		jtis: make(map[string]time.Time),
+		now:  time.Now,
+	}
+}
+
+func (c *MemoryReplayCache) Use(jti string, expiresAt time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.sweeper.due(now) {
+		sweepExpired(c.jtis, now, func(exp time.Time) time.Time { return exp })
+	}
+	// Un jti expiré mais pas encore purgé peut être réutilisé.
+	if exp, ok := c.jtis[jti]; ok && !now.After(exp) {
+		return ErrReplayDetected
+	}
+	c.jtis[jti] = expiresAt
+	return nil
+}
+
+// UsedJTI est un jti enregistré par GormReplayCache.
+type UsedJTI struct {
+	JTI       string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// GormReplayCache est un ReplayCache persistant construit sur dbcrudops,
+// partagé par toutes les instances qui utilisent la même base.
+type GormReplayCache struct {
+	operator *dbcrudops.Operator
+	now      func() time.Time
+}
+
+// NewGormReplayCache crée un GormReplayCache et migre la table des jti utilisés.
+func NewGormReplayCache(operator *dbcrudops.Operator) (*GormReplayCache, error) {
+	if err := operator.Migrate(&UsedJTI{}); err != nil {
+		return nil, err
+	}
+	return &GormReplayCache{operator: operator, now: time.Now}, nil
+}
+
+func (c *GormReplayCache) Use(jti string, expiresAt time.Time) error {
+	db := c.operator.GetDb()
+	if err := db.Where("expires_at <= ?", c.now().UTC()).Delete(&UsedJTI{}).Error; err != nil {
+		return err
+	}
+	// L'insertion est ignorée si le jti existe : un seul appel concurrent l'enregistre.
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&UsedJTI{JTI: jti, ExpiresAt: expiresAt.UTC()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReplayDetected
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	// ErrTokenRevoked est retournée lorsqu'un token a été révoqué avant son expiration.
+	ErrTokenRevoked = errors.New("token revoked")
+	// ErrNoRevocationStore est retournée lorsqu'une révocation est demandée sans RevocationStore.
+	ErrNoRevocationStore = errors.New("revocation store not configured")
+)
+
+// RevokeToken révoque un token jusqu'à son expiration. Un token déjà expiré est ignoré.
+func (j *Tools) RevokeToken(tokenString string) error {
+	err := j.revokeToken(tokenString)
+	if err != nil {
+		j.errChan <- err
+		return err
+	}
+	return nil
+}
+
+// RevokeTokenID révoque le token identifié par jti jusqu'à expiresAt.
+func (j *Tools) RevokeTokenID(jti string, expiresAt time.Time) error {
+	err := ErrNoRevocationStore
+	if j.revocationStore != nil {
+		err = j.revocationStore.Revoke(jti, expiresAt)
+	}
+	if err != nil {
+		j.errChan <- err
+		return err
+	}
+	return nil
+}
+
+// RevokeSubject révoque tous les tokens du sujet émis avant la date before.
+func (j *Tools) RevokeSubject(subject string, before time.Time) error {
+	err := ErrNoRevocationStore
+	if j.revocationStore != nil {
+		err = j.revocationStore.RevokeSubject(subject, before)
+	}
+	if err != nil {
+		j.errChan <- err
+		return err
+	}
+	return nil
+}
+
+func (j *Tools) revokeToken(tokenString string) error {
+	if j.revocationStore == nil {
+		return ErrNoRevocationStore
+	}
+	claims, err := j.parse(tokenString, j.newValidateConfig(nil))
+	if err != nil {
+		if errors.Is(err, ErrTokenExpired) {
+			return nil
+		}
+		return err
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return jwt.NewValidationError("token has no jti", jwt.ValidationErrorClaimsInvalid)
+	}
+	expiresAt := j.now().Add(j.ttl)
+	if exp, ok := claims["exp"].(float64); ok {
+		expiresAt = time.Unix(int64(exp), 0)
+	}
+	return j.revocationStore.Revoke(jti, expiresAt)
+}
+
+// checkRevocation refuse les tokens dont le jti est révoqué,
+// ou dont le sujet a été révoqué après leur émission.
+func (j *Tools) checkRevocation(claims jwt.MapClaims) error {
+	if j.revocationStore == nil {
+		return nil
+	}
+	if jti, _ := claims["jti"].(string); jti != "" {
+		revoked, err := j.revocationStore.IsRevoked(jti)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+	if subject, _ := claims["sub"].(string); subject != "" {
+		before, err := j.revocationStore.SubjectRevokedBefore(subject)
+		if err != nil {
+			return err
+		}
+		if before.IsZero() {
+			return nil
+		}
+		// iat est tronqué à la seconde : un token émis dans la seconde de la révocation reste valide,
+		// pour qu'un utilisateur qui se reconnecte aussitôt après sa déconnexion ne reçoive pas un token révoqué.
+		iat, ok := claims["iat"].(float64)
+		if !ok || int64(iat) < before.Unix() {
+			return ErrTokenRevoked
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+)
+
+// RevocationStore conserve la liste des tokens révoqués avant leur expiration.
+type RevocationStore interface {
+	// Revoke révoque le token identifié par jti jusqu'à son expiration.
+	Revoke(jti string, expiresAt time.Time) error
+	// IsRevoked indique si le token identifié par jti est révoqué.
+	IsRevoked(jti string) (bool, error)
+	// RevokeSubject révoque tous les tokens du sujet émis avant la date before.
+	RevokeSubject(subject string, before time.Time) error
+	// SubjectRevokedBefore retourne la date avant laquelle les tokens du sujet sont révoqués,
+	// ou une date nulle.
+	SubjectRevokedBefore(subject string) (time.Time, error)
+}
+
+// MemoryRevocationStore est un RevocationStore en mémoire : les jti révoqués
+// sont oubliés une fois le token expiré, les révocations par sujet après SubjectRetention.
+type MemoryRevocationStore struct {
+	mu               sync.Mutex
+	tokens           map[string]time.Time
+	subjects         map[string]time.Time
+	subjectRetention time.Duration
+	sweeper          memorySweeper
+	now              func() time.Time
+}
+
+// MemoryRevocationOption configure un MemoryRevocationStore.
+type MemoryRevocationOption func(*MemoryRevocationStore)
+
+// SubjectRetention définit la durée pendant laquelle une révocation par sujet est conservée.
+// Elle doit couvrir la durée de vie du plus long des tokens : au-delà, les tokens émis avant
+// la révocation ont expiré. Par défaut, 30 jours, la durée de vie par défaut des refresh tokens.
+func SubjectRetention(retention time.Duration) MemoryRevocationOption {
+	return func(s *MemoryRevocationStore) {
+		s.subjectRetention = retention
+	}
+}
+
+// NewMemoryRevocationStore crée un RevocationStore en mémoire.
+func NewMemoryRevocationStore(opts ...MemoryRevocationOption) *MemoryRevocationStore {
+	s := &MemoryRevocationStore{
+		tokens:           make(map[string]time.Time),
+		subjects:         make(map[string]time.Time),
+		subjectRetention: defaultRefreshTTL,
+		now:              time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// sweep oublie les jti expirés et les révocations par sujet dont la rétention est écoulée.
+// L'appelant détient s.mu.
+func (s *MemoryRevocationStore) sweep(now time.Time) {
+	if !s.sweeper.due(now) {
+		return
+	}
+	sweepExpired(s.tokens, now, func(exp time.Time) time.Time { return exp })
+	sweepExpired(s.subjects, now, func(before time.Time) time.Time { return before.Add(s.subjectRetention) })
+}
+
+func (s *MemoryRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	if now.Before(expiresAt) {
+		s.tokens[jti] = expiresAt
+	}
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exp, ok := s.tokens[jti]
+	if !ok {
+		return false, nil
+	}
+	if !s.now().Before(exp) {
+		delete(s.tokens, jti)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *MemoryRevocationStore) RevokeSubject(subject string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(s.now())
+	if before.After(s.subjects[subject]) {
+		s.subjects[subject] = before
+	}
+	return nil
+}
+
+func (s *MemoryRevocationStore) SubjectRevokedBefore(subject string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := s.subjects[subject]
+	if s.now().Sub(before) > s.subjectRetention {
+		return time.Time{}, nil
+	}
+	return before, nil
+}
+
+// RevokedToken est l'enregistrement d'un jti révoqué.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// RevokedSubject est l'enregistrement de la date de révocation des tokens d'un sujet.
+type RevokedSubject struct {
+	Subject       string `gorm:"primaryKey"`
+	RevokedBefore time.Time
+}
+
+// GormRevocationStore est un RevocationStore persistant construit sur dbcrudops.
+type GormRevocationStore struct {
+	operator *dbcrudops.Operator
+	now      func() time.Time
+}
+
+// NewGormRevocationStore crée un GormRevocationStore et migre ses tables.
+func NewGormRevocationStore(operator *dbcrudops.Operator) (*GormRevocationStore, error) {
+	if err := operator.Migrate(&RevokedToken{}, &RevokedSubject{}); err != nil {
+		return nil, err
+	}
+	return &GormRevocationStore{operator: operator, now: time.Now}, nil
+}
+
+func (s *GormRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	return s.operator.Update(&RevokedToken{JTI: jti, ExpiresAt: expiresAt.UTC()})
+}
+
+func (s *GormRevocationStore) IsRevoked(jti string) (bool, error) {
+	var count int64
+	err := s.operator.GetDb().Model(&RevokedToken{}).
+		Where("jti = ? AND expires_at > ?", jti, s.now().UTC()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *GormRevocationStore) RevokeSubject(subject string, before time.Time) error {
+	current, err := s.SubjectRevokedBefore(subject)
+	if err != nil {
+		return err
+	}
+	if !before.After(current) {
+		return nil
+	}
+	return s.operator.Update(&RevokedSubject{Subject: subject, RevokedBefore: before})
+}
+
+func (s *GormRevocationStore) SubjectRevokedBefore(subject string) (time.Time, error) {
+	var records []RevokedSubject
+	if err := s.operator.FindByKey(&records, "subject", subject); err != nil {
+		return time.Time{}, err
+	}
+	if len(records) == 0 {
+		return time.Time{}, nil
+	}
+	return records[0].RevokedBefore, nil
+}
+
+// PurgeExpired supprime les jti révoqués dont le token a expiré.
+func (s *GormRevocationStore) PurgeExpired() error {
+	return s.operator.GetDb().Where("expires_at <= ?", s.now().UTC()).Delete(&RevokedToken{}).Error
+}
@@ -0,0 +1,116 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRevokeTokenMemory(t *testing.T) {
+	testRevocation(t, NewMemoryRevocationStore())
+}
+
+func TestRevokeTokenGorm(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	assert.NoError(t, err)
+	operator := dbcrudops.New(db)
+	operator.OnError(func(error) {})
+	store, err := NewGormRevocationStore(operator)
+	assert.NoError(t, err)
+
+	testRevocation(t, store)
+	assert.NoError(t, store.PurgeExpired())
+}
+
+func testRevocation(t *testing.T, store RevocationStore) {
+	t.Helper()
+	j := newTestTools(t, time.Hour)
+	j.revocationStore = store
+
+	token, err := j.GenerateToken("testData", Subject("user-42"))
+	assert.NoError(t, err)
+	other, err := j.GenerateToken("testData", Subject("user-7"))
+	assert.NoError(t, err)
+
+	// A revoked token is rejected, other tokens are not.
+	assert.NoError(t, j.RevokeToken(token))
+	_, err = j.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = j.ValidateToken(other)
+	assert.NoError(t, err)
+
+	// Revoking a subject rejects every token issued before the cutoff.
+	now := time.Now().Add(time.Second)
+	j.now = func() time.Time { return now }
+	assert.NoError(t, j.RevokeSubject("user-7", now))
+	_, err = j.ValidateToken(other)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	now = now.Add(time.Second)
+	fresh, err := j.GenerateToken("testData", Subject("user-7"))
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(fresh)
+	assert.NoError(t, err)
+
+	// Refresh tokens of a revoked subject cannot be exchanged either.
+	pair, err := j.IssueTokenPair("testData", Subject("user-9"))
+	assert.NoError(t, err)
+	now = now.Add(time.Second)
+	assert.NoError(t, j.RevokeSubject("user-9", now))
+	_, err = j.RefreshTokenPair(pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+}
+
+func TestRevokeSubjectSameSecond(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	j.revocationStore = NewMemoryRevocationStore()
+	now := time.Now().Truncate(time.Second)
+	j.now = func() time.Time { return now }
+	before, err := j.GenerateToken("testData", Subject("user-7"))
+	assert.NoError(t, err)
+
+	// L'utilisateur se déconnecte puis se reconnecte dans la même seconde.
+	now = now.Add(1500 * time.Millisecond)
+	assert.NoError(t, j.RevokeSubject("user-7", now))
+	now = now.Add(100 * time.Millisecond)
+	after, err := j.GenerateToken("testData", Subject("user-7"))
+	assert.NoError(t, err)
+
+	_, err = j.ValidateToken(before)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = j.ValidateToken(after)
+	assert.NoError(t, err)
+}
+
+func TestMemoryRevocationStoreSubjectRetention(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryRevocationStore(SubjectRetention(time.Hour))
+	store.now = func() time.Time { return now }
+	assert.NoError(t, store.RevokeSubject("user-7", now))
+
+	now = now.Add(30 * time.Minute)
+	before, err := store.SubjectRevokedBefore("user-7")
+	assert.NoError(t, err)
+	assert.True(t, before.Equal(now.Add(-30*time.Minute)))
+
+	// Passé la rétention, la révocation est oubliée : les tokens émis avant elle ont expiré.
+	now = now.Add(time.Hour)
+	before, err = store.SubjectRevokedBefore("user-7")
+	assert.NoError(t, err)
+	assert.True(t, before.IsZero())
+	assert.NoError(t, store.RevokeSubject("user-9", now))
+	assert.NotContains(t, store.subjects, "user-7")
+}
+
+func TestRevokeWithoutStore(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	token, err := j.GenerateToken("testData")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, j.RevokeToken(token), ErrNoRevocationStore)
+	assert.ErrorIs(t, j.RevokeSubject("user-42", time.Now()), ErrNoRevocationStore)
+}
@@ -0,0 +1,162 @@
+package jwt
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// sessionClaim porte l'identifiant de session (claim sid d'OpenID Connect).
+const sessionClaim = "sid"
+
+var (
+	// ErrSessionTerminated est retournée quand le token appartient à une session terminée ou expirée.
+	ErrSessionTerminated = errors.New("session terminated")
+	// ErrSessionNotFound est retournée quand une session est inconnue.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrNoSessionStore est retournée quand une session est demandée sans SessionStore.
+	ErrNoSessionStore = errors.New("session store not configured")
+)
+
+// Device décrit l'appareil depuis lequel une session est ouverte.
+type Device struct {
+	Name      string // nom lisible, par exemple « iPhone de Awa » ; optionnel
+	UserAgent string
+	IP        string
+}
+
+// DeviceFromRequest retourne l'agent utilisateur et l'adresse IP de la requête.
+// L'adresse est celle de la connexion : derrière un reverse proxy, renseignez IP vous-même.
+func DeviceFromRequest(r *http.Request) Device {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return Device{UserAgent: r.UserAgent(), IP: ip}
+}
+
+// SessionIDOf retourne l'identifiant de session d'un token, ou "" s'il n'appartient à aucune session.
+func SessionIDOf(claims jwt.MapClaims) string {
+	sid, _ := claims[sessionClaim].(string)
+	return sid
+}
+
+// StartSession ouvre une session pour l'appareil et émet sa paire de tokens, comme IssueTokenPair.
+// Le sujet (option Subject) est obligatoire. Les tokens portent l'identifiant de session (claim sid),
+// qui est aussi leur famille : terminer la session les fait refuser par ValidateToken et RefreshTokenPair.
+func (j *Tools) StartSession(data interface{}, device Device, opts ...TokenOption) (*TokenPair, error) {
+	pair, err := j.startSession(data, device, opts)
+	if err != nil {
+		j.errChan <- err
+		return nil, err
+	}
+	return pair, nil
+}
+
+func (j *Tools) startSession(data interface{}, device Device, opts []TokenOption) (*TokenPair, error) {
+	if j.sessionStore == nil {
+		return nil, ErrNoSessionStore
+	}
+	subject := j.newTokenConfig(opts).subject
+	if subject == "" {
+		return nil, errors.New("a session requires a subject")
+	}
+	now := j.now()
+	session := &Session{
+		ID:         newID(),
+		Subject:    subject,
+		Device:     device.Name,
+		UserAgent:  device.UserAgent,
+		IP:         device.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(j.refreshTTL),
+	}
+	if err := j.sessionStore.Create(session); err != nil {
+		return nil, err
+	}
+	pair, err := j.issuePair(data, session.ID, append(opts, withClaim(sessionClaim, session.ID)), nil)
+	if err != nil {
+		// Une session sans token ne doit pas apparaître parmi les sessions actives.
+		if terminateErr := j.sessionStore.Terminate(session.ID); terminateErr != nil {
+			return nil, errors.Join(err, terminateErr)
+		}
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Sessions retourne les sessions actives du sujet, de la plus récemment utilisée à la plus ancienne.
+func (j *Tools) Sessions(subject string) ([]Session, error) {
+	err := ErrNoSessionStore
+	var sessions []Session
+	if j.sessionStore != nil {
+		sessions, err = j.sessionStore.List(subject, j.now())
+	}
+	if err != nil {
+		j.errChan <- err
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// TerminateSession termine la session id du sujet, par exemple depuis la liste des appareils.
+// Une session d'un autre sujet est traitée comme inconnue (ErrSessionNotFound).
+func (j *Tools) TerminateSession(subject, id string) error {
+	err := ErrNoSessionStore
+	if j.sessionStore != nil {
+		err = j.terminateSession(subject, id)
+	}
+	if err != nil {
+		j.errChan <- err
+		return err
+	}
+	return nil
+}
+
+func (j *Tools) terminateSession(subject, id string) error {
+	session, err := j.sessionStore.Session(id)
+	if err != nil {
+		return err
+	}
+	if session.Subject != subject {
+		return ErrSessionNotFound
+	}
+	return j.sessionStore.Terminate(id)
+}
+
+// TerminateSessions termine toutes les sessions du sujet, sauf celles de keep
+// (typiquement la session courante, voir SessionIDOf).
+func (j *Tools) TerminateSessions(subject string, keep ...string) error {
+	err := ErrNoSessionStore
+	if j.sessionStore != nil {
+		err = j.sessionStore.TerminateAll(subject, keep)
+	}
+	if err != nil {
+		j.errChan <- err
+		return err
+	}
+	return nil
+}
+
+// checkSession refuse les tokens dont la session est terminée, expirée ou inconnue.
+// Les tokens émis hors session (sans claim sid) ne sont pas concernés.
+func (j *Tools) checkSession(claims jwt.MapClaims) error {
+	sid := SessionIDOf(claims)
+	if sid == "" || j.sessionStore == nil {
+		return nil
+	}
+	session, err := j.sessionStore.Session(sid)
+	if errors.Is(err, ErrSessionNotFound) {
+		return ErrSessionTerminated
+	}
+	if err != nil {
+		return err
+	}
+	if !session.active(j.now()) {
+		return ErrSessionTerminated
+	}
+	return nil
+}
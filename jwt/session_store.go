@@ -0,0 +1,188 @@
+package jwt
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+)
+
+// SessionStore conserve les sessions ouvertes par StartSession.
+type SessionStore interface {
+	// Create enregistre une nouvelle session.
+	Create(session *Session) error
+	// Session retourne une session, terminée ou non, ou ErrSessionNotFound.
+	Session(id string) (*Session, error)
+	// List retourne les sessions actives du sujet, de la plus récemment utilisée à la plus ancienne.
+	List(subject string, now time.Time) ([]Session, error)
+	// Touch met à jour la date de dernière activité de la session.
+	Touch(id string, at time.Time) error
+	// Terminate termine une session.
+	Terminate(id string) error
+	// TerminateAll termine toutes les sessions du sujet, sauf celles de keep.
+	TerminateAll(subject string, keep []string) error
+}
+
+// Session décrit une session : une famille de tokens émise pour un appareil.
+type Session struct {
+	ID         string `gorm:"primaryKey"`
+	Subject    string `gorm:"index"`
+	Device     string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	Terminated bool
+}
+
+// active indique si la session n'est ni terminée ni expirée.
+func (s *Session) active(now time.Time) bool {
+	return !s.Terminated && now.Before(s.ExpiresAt)
+}
+
+// MemorySessionStore est un SessionStore en mémoire, adapté aux tests et aux instances uniques.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	sweeper  memorySweeper
+	now      func() time.Time
+}
+
+// NewMemorySessionStore crée un SessionStore en mémoire.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]*Session),
+		now:      time.Now,
+	}
+}
+
+func (s *MemorySessionStore) Create(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := s.now(); s.sweeper.due(now) {
+		sweepExpired(s.sessions, now, func(session *Session) time.Time { return session.ExpiresAt })
+	}
+	saved := *session
+	s.sessions[session.ID] = &saved
+	return nil
+}
+
+func (s *MemorySessionStore) Session(id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	found := *session
+	return &found, nil
+}
+
+func (s *MemorySessionStore) List(subject string, now time.Time) ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sessions []Session
+	for _, session := range s.sessions {
+		if session.Subject == subject && session.active(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) Touch(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	session.LastSeenAt = at
+	return nil
+}
+
+func (s *MemorySessionStore) Terminate(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[id]; ok {
+		session.Terminated = true
+	}
+	return nil
+}
+
+func (s *MemorySessionStore) TerminateAll(subject string, keep []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.sessions {
+		if session.Subject == subject && !slices.Contains(keep, id) {
+			session.Terminated = true
+		}
+	}
+	return nil
+}
+
+// GormSessionStore est un SessionStore persistant construit sur dbcrudops.
+type GormSessionStore struct {
+	operator *dbcrudops.Operator
+}
+
+// NewGormSessionStore crée un GormSessionStore et migre la table des sessions.
+func NewGormSessionStore(operator *dbcrudops.Operator) (*GormSessionStore, error) {
+	if err := operator.Migrate(&Session{}); err != nil {
+		return nil, err
+	}
+	return &GormSessionStore{operator: operator}, nil
+}
+
+func (s *GormSessionStore) Create(session *Session) error {
+	return s.operator.Create(session)
+}
+
+func (s *GormSessionStore) Session(id string) (*Session, error) {
+	var session Session
+	found := s.operator.GetDb().Where("id = ?", id).Limit(1).Find(&session)
+	if found.Error != nil {
+		return nil, found.Error
+	}
+	if found.RowsAffected == 0 {
+		return nil, ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+func (s *GormSessionStore) List(subject string, now time.Time) ([]Session, error) {
+	var sessions []Session
+	err := s.operator.GetDb().
+		Where("subject = ? AND terminated = ? AND expires_at > ?", subject, false, now).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (s *GormSessionStore) Touch(id string, at time.Time) error {
+	result := s.operator.GetDb().Model(&Session{}).Where("id = ?", id).Update("last_seen_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *GormSessionStore) Terminate(id string) error {
+	return s.operator.GetDb().Model(&Session{}).Where("id = ?", id).Update("terminated", true).Error
+}
+
+func (s *GormSessionStore) TerminateAll(subject string, keep []string) error {
+	query := s.operator.GetDb().Model(&Session{}).Where("subject = ?", subject)
+	if len(keep) > 0 {
+		query = query.Where("id NOT IN ?", keep)
+	}
+	return query.Update("terminated", true).Error
+}
@@ -0,0 +1,145 @@
+package jwt
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func testSessions(t *testing.T, store SessionStore) {
+	j := newTestTools(t, time.Hour)
+	WithSessionStore(store)(j)
+
+	phone, err := j.StartSession("data", Device{Name: "phone", UserAgent: "ios", IP: "10.0.0.1"}, Subject("user-1"))
+	assert.NoError(t, err)
+	j.now = func() time.Time { return time.Now().Add(time.Second) }
+	laptop, err := j.StartSession("data", Device{Name: "laptop"}, Subject("user-1"))
+	assert.NoError(t, err)
+	_, err = j.StartSession("data", Device{Name: "other"}, Subject("user-2"))
+	assert.NoError(t, err)
+
+	claims, err := j.ValidateToken(phone.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, phone.Family, SessionIDOf(claims))
+
+	sessions, err := j.Sessions("user-1")
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 2) {
+		assert.Equal(t, laptop.Family, sessions[0].ID)
+		assert.Equal(t, "phone", sessions[1].Device)
+		assert.Equal(t, "ios", sessions[1].UserAgent)
+		assert.Equal(t, "10.0.0.1", sessions[1].IP)
+	}
+
+	// Le refresh conserve la session et met à jour sa dernière activité.
+	j.now = func() time.Time { return time.Now().Add(time.Minute) }
+	phone, err = j.RefreshTokenPair(phone.RefreshToken)
+	assert.NoError(t, err)
+	claims, err = j.ValidateToken(phone.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, phone.Family, SessionIDOf(claims))
+	sessions, err = j.Sessions("user-1")
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 2) {
+		assert.Equal(t, phone.Family, sessions[0].ID)
+	}
+
+	// Un sujet ne peut pas terminer la session d'un autre.
+	assert.ErrorIs(t, j.TerminateSession("user-2", phone.Family), ErrSessionNotFound)
+	assert.ErrorIs(t, j.TerminateSession("user-1", "unknown"), ErrSessionNotFound)
+
+	assert.NoError(t, j.TerminateSession("user-1", phone.Family))
+	_, err = j.ValidateToken(phone.AccessToken)
+	assert.ErrorIs(t, err, ErrSessionTerminated)
+	_, err = j.RefreshTokenPair(phone.RefreshToken)
+	assert.Error(t, err)
+	_, err = j.ValidateToken(laptop.AccessToken)
+	assert.NoError(t, err)
+
+	sessions, err = j.Sessions("user-1")
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
+
+func TestSessionsMemory(t *testing.T) {
+	testSessions(t, NewMemorySessionStore())
+}
+
+func TestSessionsGorm(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	assert.NoError(t, err)
+	operator := dbcrudops.New(db)
+	operator.OnError(func(error) {})
+	store, err := NewGormSessionStore(operator)
+	assert.NoError(t, err)
+	testSessions(t, store)
+}
+
+func TestTerminateSessions(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	WithSessionStore(NewMemorySessionStore())(j)
+
+	current, err := j.StartSession("data", Device{}, Subject("user-1"))
+	assert.NoError(t, err)
+	other, err := j.StartSession("data", Device{}, Subject("user-1"))
+	assert.NoError(t, err)
+
+	// « Déconnecter les autres appareils » : la session courante est conservée.
+	assert.NoError(t, j.TerminateSessions("user-1", current.Family))
+	_, err = j.ValidateToken(current.AccessToken)
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(other.AccessToken)
+	assert.ErrorIs(t, err, ErrSessionTerminated)
+
+	assert.NoError(t, j.TerminateSessions("user-1"))
+	_, err = j.ValidateToken(current.AccessToken)
+	assert.ErrorIs(t, err, ErrSessionTerminated)
+	sessions, err := j.Sessions("user-1")
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestSessionRefreshReuseTerminatesSession(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	WithSessionStore(NewMemorySessionStore())(j)
+
+	pair, err := j.StartSession("data", Device{}, Subject("user-1"))
+	assert.NoError(t, err)
+	_, err = j.RefreshTokenPair(pair.RefreshToken)
+	assert.NoError(t, err)
+	_, err = j.RefreshTokenPair(pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	_, err = j.ValidateToken(pair.AccessToken)
+	assert.ErrorIs(t, err, ErrSessionTerminated)
+}
+
+func TestStartSessionErrors(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	_, err := j.StartSession("data", Device{}, Subject("user-1"))
+	assert.ErrorIs(t, err, ErrNoSessionStore)
+	_, err = j.Sessions("user-1")
+	assert.ErrorIs(t, err, ErrNoSessionStore)
+
+	WithSessionStore(NewMemorySessionStore())(j)
+	_, err = j.StartSession("data", Device{})
+	assert.Error(t, err)
+
+	// Les tokens émis hors session ne dépendent pas du registre.
+	token, err := j.GenerateToken("data", Subject("user-1"))
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(token)
+	assert.NoError(t, err)
+}
+
+func TestDeviceFromRequest(t *testing.T) {
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.RemoteAddr = "192.0.2.1:4321"
+	r.Header.Set("User-Agent", "Mozilla/5.0")
+	assert.Equal(t, Device{UserAgent: "Mozilla/5.0", IP: "192.0.2.1"}, DeviceFromRequest(r))
+}
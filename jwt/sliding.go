@@ -0,0 +1,148 @@
+package jwt
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// authTimeClaim porte la date de l'authentification initiale (claim auth_time d'OpenID Connect) :
+// elle borne la durée de vie totale des tokens renouvelés.
+const authTimeClaim = "auth_time"
+
+// RenewedTokenHeader est l'en-tête de réponse portant le token renouvelé par SlidingExpiry,
+// lorsque le token n'a pas été présenté dans un cookie.
+const RenewedTokenHeader = "X-Renewed-Token"
+
+// ErrSessionIdle est retournée quand une session est restée inactive plus longtemps que IdleTimeout.
+var ErrSessionIdle = errors.New("session idle timeout exceeded")
+
+// reissuedClaims sont recalculés à chaque renouvellement ; les autres claims sont recopiés.
+var reissuedClaims = []string{"data", "exp", "iat", "nbf", "jti", "iss", "sub", "aud"}
+
+// SlidingExpiry active le renouvellement glissant : quand il reste moins de renewWithin avant
+// l'expiration d'un token valide, le middleware émet un nouveau token avec les mêmes claims et
+// la durée de validité de l'instance. Le nouveau token remplace le cookie si le token y a été lu
+// (voir TokenFromCookie), sinon il est renvoyé dans l'en-tête RenewedTokenHeader.
+//
+// Aucun token renouvelé n'expire plus de maxLifetime après l'authentification initiale
+// (claim auth_time, à défaut iat du premier token) ; maxLifetime nul désactive cette limite.
+func SlidingExpiry(renewWithin, maxLifetime time.Duration) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.renewWithin = renewWithin
+		c.maxLifetime = maxLifetime
+	}
+}
+
+// CookieAttributes sont les attributs du cookie réécrit par SlidingExpiry.
+type CookieAttributes struct {
+	Path     string
+	Domain   string
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// defaultCookieAttributes sont les attributs du cookie renouvelé sans RenewedCookie.
+var defaultCookieAttributes = CookieAttributes{Path: "/", Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode}
+
+// RenewedCookie définit les attributs du cookie réécrit par SlidingExpiry. Ils doivent reprendre
+// ceux du cookie posé par l'application : avec un autre Path ou Domain, le navigateur garderait
+// deux cookies du même nom, et un cookie Secure n'est pas conservé sur une connexion HTTP
+// (développement local). Par défaut : Path "/", Secure, HttpOnly et SameSite=Lax.
+func RenewedCookie(attrs CookieAttributes) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.renewedCookie = &attrs
+	}
+}
+
+// IdleTimeout refuse les tokens d'une session (voir StartSession) restée sans requête plus longtemps
+// que timeout, et termine cette session. Chaque requête acceptée met à jour son activité.
+// Les tokens émis hors session ne sont pas concernés.
+func IdleTimeout(timeout time.Duration) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.idleTimeout = timeout
+	}
+}
+
+// checkIdle applique IdleTimeout à la session du token puis enregistre l'activité.
+func (j *Tools) checkIdle(claims jwt.MapClaims, timeout time.Duration) error {
+	sid := SessionIDOf(claims)
+	if sid == "" || j.sessionStore == nil {
+		return nil
+	}
+	session, err := j.sessionStore.Session(sid)
+	if err != nil {
+		return err
+	}
+	now := j.now()
+	if now.Sub(session.LastSeenAt) > timeout {
+		if err := j.sessionStore.Terminate(sid); err != nil {
+			return err
+		}
+		return &TokenError{Reason: ErrSessionIdle, Claim: sessionClaim}
+	}
+	return j.sessionStore.Touch(sid, now)
+}
+
+// renew émet le token de remplacement de SlidingExpiry, ou "" si le token n'a pas à être renouvelé.
+func (j *Tools) renew(claims jwt.MapClaims, renewWithin, maxLifetime time.Duration) (string, time.Time, error) {
+	now := j.now()
+	exp := time.Unix(int64Claim(claims, "exp"), 0)
+	if exp.Sub(now) >= renewWithin {
+		return "", time.Time{}, nil
+	}
+	authTime := int64Claim(claims, authTimeClaim)
+	if authTime == 0 {
+		authTime = int64Claim(claims, "iat")
+	}
+	cfg := &tokenConfig{
+		ttl:      j.ttl,
+		issuer:   stringClaim(claims, "iss"),
+		audience: stringsClaim(claims["aud"]),
+		subject:  stringClaim(claims, "sub"),
+		claims:   jwt.MapClaims{authTimeClaim: authTime},
+	}
+	if maxLifetime > 0 {
+		if limit := time.Unix(authTime, 0).Add(maxLifetime); limit.Before(now.Add(cfg.ttl)) {
+			cfg.ttl = limit.Sub(now)
+		}
+	}
+	// La limite est atteinte : le token actuel expirera sans remplaçant.
+	if !now.Add(cfg.ttl).After(exp) {
+		return "", time.Time{}, nil
+	}
+	for name, value := range claims {
+		if !slices.Contains(reissuedClaims, name) {
+			cfg.claims[name] = value
+		}
+	}
+	return j.generate(claims["data"], cfg)
+}
+
+// writeRenewedToken transmet le token renouvelé par le même canal que le token présenté.
+func (c *middlewareConfig) writeRenewedToken(w http.ResponseWriter, r *http.Request, presented, token string, exp time.Time) {
+	if c.cookie != "" {
+		if cookie, err := r.Cookie(c.cookie); err == nil && cookie.Value == presented {
+			attrs := defaultCookieAttributes
+			if c.renewedCookie != nil {
+				attrs = *c.renewedCookie
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     c.cookie,
+				Value:    token,
+				Path:     attrs.Path,
+				Domain:   attrs.Domain,
+				Expires:  exp,
+				Secure:   attrs.Secure,
+				HttpOnly: attrs.HttpOnly,
+				SameSite: attrs.SameSite,
+			})
+			return
+		}
+	}
+	w.Header().Set(RenewedTokenHeader, token)
+}
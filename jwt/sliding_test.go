@@ -0,0 +1,147 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingExpiry(t *testing.T) {
+	j := newTestTools(t, 15*time.Minute)
+	start := time.Now()
+	now := start
+	j.now = func() time.Time { return now }
+	token, err := j.GenerateToken("data", Subject("user-1"), Roles("admin"), Audience("back-office"))
+	assert.NoError(t, err)
+
+	handler := j.Middleware(SlidingExpiry(5*time.Minute, time.Hour))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Loin de l'expiration : pas de renouvellement.
+	rec := serve(token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(RenewedTokenHeader))
+
+	// Sous le seuil : un nouveau token portant les mêmes claims est émis.
+	now = start.Add(12 * time.Minute)
+	rec = serve(token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	renewed := rec.Header().Get(RenewedTokenHeader)
+	if assert.NotEmpty(t, renewed) {
+		claims, err := j.ValidateToken(renewed)
+		assert.NoError(t, err)
+		assert.Equal(t, "user-1", claims["sub"])
+		assert.Equal(t, "data", claims["data"])
+		assert.Equal(t, "back-office", claims["aud"])
+		assert.Equal(t, []interface{}{"admin"}, claims[rolesClaim])
+		assert.EqualValues(t, start.Unix(), claims[authTimeClaim])
+		assert.EqualValues(t, now.Add(15*time.Minute).Unix(), claims["exp"])
+	}
+
+	// La durée de vie totale est bornée par maxLifetime depuis l'authentification initiale.
+	for now.Before(start.Add(40 * time.Minute)) {
+		now = now.Add(11 * time.Minute)
+		renewed = serve(renewed).Header().Get(RenewedTokenHeader)
+		assert.NotEmpty(t, renewed)
+	}
+	claims := unverifiedClaims(t, renewed)
+	assert.EqualValues(t, start.Add(time.Hour).Unix(), claims["exp"])
+
+	now = start.Add(56 * time.Minute)
+	rec = serve(renewed)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(RenewedTokenHeader))
+
+	now = start.Add(time.Hour + time.Second)
+	assert.Equal(t, http.StatusUnauthorized, serve(renewed).Code)
+}
+
+func TestSlidingExpiryCookie(t *testing.T) {
+	j := newTestTools(t, 15*time.Minute)
+	token, err := j.GenerateToken("data", Subject("user-1"))
+	assert.NoError(t, err)
+	j.now = func() time.Time { return time.Now().Add(14 * time.Minute) }
+
+	handler := j.Middleware(TokenFromCookie("session"), SlidingExpiry(5*time.Minute, 0))(
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: token})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(RenewedTokenHeader))
+	cookies := rec.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "session", cookies[0].Name)
+		assert.True(t, cookies[0].HttpOnly)
+		_, err := j.ValidateToken(cookies[0].Value)
+		assert.NoError(t, err)
+		assert.NotEqual(t, token, cookies[0].Value)
+		assert.Equal(t, "/", cookies[0].Path)
+		assert.True(t, cookies[0].Secure)
+	}
+
+	// Les attributs du cookie renouvelé reprennent ceux du cookie de l'application.
+	handler = j.Middleware(TokenFromCookie("session"), SlidingExpiry(5*time.Minute, 0),
+		RenewedCookie(CookieAttributes{Path: "/admin", Domain: "example.com", HttpOnly: true, SameSite: http.SameSiteStrictMode}))(
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	cookies = rec.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "/admin", cookies[0].Path)
+		assert.Equal(t, "example.com", cookies[0].Domain)
+		assert.False(t, cookies[0].Secure)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	WithSessionStore(NewMemorySessionStore())(j)
+	start := time.Now()
+	now := start
+	j.now = func() time.Time { return now }
+	pair, err := j.StartSession("data", Device{}, Subject("user-1"))
+	assert.NoError(t, err)
+	plain, err := j.GenerateToken("data", Subject("user-1"))
+	assert.NoError(t, err)
+
+	handler := j.Middleware(IdleTimeout(10 * time.Minute))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Chaque requête repousse l'échéance d'inactivité.
+	for i := 0; i < 3; i++ {
+		now = now.Add(9 * time.Minute)
+		assert.Equal(t, http.StatusOK, serve(pair.AccessToken).Code)
+	}
+
+	now = now.Add(11 * time.Minute)
+	rec := serve(pair.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), ErrSessionIdle.Error())
+
+	// La session est terminée : le refresh token est refusé lui aussi.
+	_, err = j.RefreshTokenPair(pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrSessionTerminated)
+
+	// Les tokens émis hors session ne sont pas concernés.
+	assert.Equal(t, http.StatusOK, serve(plain).Code)
+}
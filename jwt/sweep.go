@@ -0,0 +1,31 @@
+package jwt
+
+import "time"
+
+// memorySweepInterval est l'intervalle minimal entre deux purges des stores en mémoire :
+// les entrées expirées ne sont pas parcourues à chaque écriture.
+const memorySweepInterval = time.Minute
+
+// memorySweeper espace les purges d'un store en mémoire d'au moins memorySweepInterval.
+// Il est protégé par le verrou du store.
+type memorySweeper struct {
+	next time.Time
+}
+
+// due indique si le store doit être purgé à now et, le cas échéant, programme la purge suivante.
+func (s *memorySweeper) due(now time.Time) bool {
+	if !now.After(s.next) {
+		return false
+	}
+	s.next = now.Add(memorySweepInterval)
+	return true
+}
+
+// sweepExpired retire de entries les entrées expirées à now.
+func sweepExpired[K comparable, V any](entries map[K]V, now time.Time, expiresAt func(V) time.Time) {
+	for key, entry := range entries {
+		if now.After(expiresAt(entry)) {
+			delete(entries, key)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySweeper(t *testing.T) {
+	// Setup
+	now := time.Unix(1700000000, 0)
+	entries := map[string]time.Time{"a": now.Add(10 * time.Second), "b": now.Add(time.Hour)}
+	var sweeper memorySweeper
+	sweep := func() {
+		if sweeper.due(now) {
+			sweepExpired(entries, now, func(exp time.Time) time.Time { return exp })
+		}
+	}
+
+	// Test & Assert
+	sweep()
+	now = now.Add(30 * time.Second)
+	sweep()
+	assert.Contains(t, entries, "a", "entries are swept at most once per interval")
+
+	now = now.Add(time.Minute)
+	sweep()
+	assert.NotContains(t, entries, "a", "expired entries are evicted")
+	assert.Contains(t, entries, "b")
+}
@@ -0,0 +1,223 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownTenant est retournée quand un token est demandé pour un tenant inconnu.
+	ErrUnknownTenant = errors.New("unknown tenant")
+	// ErrUnknownIssuer est la raison du refus d'un token dont l'émetteur n'est aucun des tenants.
+	ErrUnknownIssuer = errors.New("unknown issuer")
+)
+
+// TenantConfig décrit un tenant : une organisation cliente, avec son émetteur et ses clés.
+type TenantConfig struct {
+	ID     string            `json:"id"`
+	Issuer string            `json:"issuer"`
+	Keys   []TenantKeyConfig `json:"keys"`
+}
+
+// TenantKeyConfig décrit une clé d'un tenant, comme Key. La clé est encodée en PEM,
+// en clair ou en base64 : une clé privée signe, une clé publique seule ne sert qu'à vérifier.
+type TenantKeyConfig struct {
+	ID         string    `json:"kid"`
+	Key        string    `json:"key"`
+	ActivateAt time.Time `json:"activate_at"`
+	RetireAt   time.Time `json:"retire_at"`
+}
+
+// TenantSource fournit la configuration des tenants.
+type TenantSource interface {
+	Tenants() ([]TenantConfig, error)
+}
+
+// StaticTenants est une TenantSource en mémoire, par exemple issue du fichier de configuration de l'application.
+type StaticTenants []TenantConfig
+
+func (s StaticTenants) Tenants() ([]TenantConfig, error) {
+	return s, nil
+}
+
+// FileTenantSource lit les tenants dans un fichier JSON contenant un tableau de TenantConfig.
+type FileTenantSource struct {
+	Path string
+}
+
+func (s FileTenantSource) Tenants() ([]TenantConfig, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []TenantConfig
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// TenantRegistry associe chaque tenant à son émetteur et à son trousseau de clés.
+// Avec WithTenants, les tokens sont signés avec les clés du tenant choisi par l'option Tenant
+// et vérifiés avec celles du tenant dont l'émetteur est le claim iss.
+type TenantRegistry struct {
+	mu       sync.RWMutex
+	byID     map[string]*tenant
+	byIssuer map[string]*tenant
+}
+
+type tenant struct {
+	id      string
+	issuer  string
+	keyRing *KeyRing
+}
+
+// NewTenantRegistry crée un registre vide.
+func NewTenantRegistry() *TenantRegistry {
+	return &TenantRegistry{
+		byID:     make(map[string]*tenant),
+		byIssuer: make(map[string]*tenant),
+	}
+}
+
+// Add enregistre un tenant. L'identifiant et l'émetteur doivent être uniques.
+func (r *TenantRegistry) Add(id, issuer string, keyRing *KeyRing) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.add(&tenant{id: id, issuer: issuer, keyRing: keyRing})
+}
+
+func (r *TenantRegistry) add(t *tenant) error {
+	if t.id == "" || t.issuer == "" || t.keyRing == nil {
+		return errors.New("a tenant requires an id, an issuer and a key ring")
+	}
+	if _, ok := r.byID[t.id]; ok {
+		return errors.New("tenant " + t.id + " already exists")
+	}
+	if _, ok := r.byIssuer[t.issuer]; ok {
+		return errors.New("issuer " + t.issuer + " already belongs to a tenant")
+	}
+	r.byID[t.id] = t
+	r.byIssuer[t.issuer] = t
+	return nil
+}
+
+// Remove retire un tenant : ses tokens sont refusés dès maintenant.
+func (r *TenantRegistry) Remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.byID[id]; ok {
+		delete(r.byID, id)
+		delete(r.byIssuer, t.issuer)
+	}
+}
+
+// KeyRing retourne le trousseau d'un tenant, pour la rotation de ses clés.
+func (r *TenantRegistry) KeyRing(id string) (*KeyRing, error) {
+	t, err := r.tenant(id)
+	if err != nil {
+		return nil, err
+	}
+	return t.keyRing, nil
+}
+
+// Load remplace tous les tenants par ceux de la source. En cas d'erreur, le registre est inchangé.
+func (r *TenantRegistry) Load(src TenantSource) error {
+	configs, err := src.Tenants()
+	if err != nil {
+		return err
+	}
+	loaded := NewTenantRegistry()
+	for _, cfg := range configs {
+		keyRing, err := tenantKeyRing(cfg.Keys)
+		if err != nil {
+			return errors.Join(errors.New("tenant "+cfg.ID), err)
+		}
+		if err := loaded.add(&tenant{id: cfg.ID, issuer: cfg.Issuer, keyRing: keyRing}); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byID, r.byIssuer = loaded.byID, loaded.byIssuer
+	return nil
+}
+
+// tenant retourne le tenant id, ou ErrUnknownTenant.
+func (r *TenantRegistry) tenant(id string) (*tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byID[id]
+	if !ok {
+		return nil, ErrUnknownTenant
+	}
+	return t, nil
+}
+
+// tenantByIssuer retourne le tenant dont l'émetteur est issuer, ou ErrUnknownIssuer.
+func (r *TenantRegistry) tenantByIssuer(issuer string) (*tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byIssuer[issuer]
+	if !ok {
+		return nil, ErrUnknownIssuer
+	}
+	return t, nil
+}
+
+// tenantKeyRing construit le trousseau d'un tenant à partir de sa configuration.
+func tenantKeyRing(keys []TenantKeyConfig) (*KeyRing, error) {
+	keyRing, err := NewKeyRing()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		material, err := decodeKeyMaterial([]byte(key.Key))
+		if err != nil {
+			return nil, errors.Join(errors.New("key "+key.ID), err)
+		}
+		err = keyRing.Add(Key{
+			ID:         key.ID,
+			PrivateKey: material.PrivateKey,
+			PublicKey:  material.PublicKey,
+			ActivateAt: key.ActivateAt,
+			RetireAt:   key.RetireAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keyRing, nil
+}
+
+// Tenant choisit le tenant dont les clés signent le token ; son émetteur remplace celui de l'instance.
+// Sans cette option, le tenant est celui dont l'émetteur est l'émetteur du token (option Issuer).
+func Tenant(id string) TokenOption {
+	return func(c *tokenConfig) {
+		c.tenant = id
+	}
+}
+
+// signingTenant retourne le tenant qui signe un token, d'après l'option Tenant ou l'émetteur.
+func (j *Tools) signingTenant(cfg *tokenConfig) (*tenant, error) {
+	if cfg.tenant != "" {
+		return j.tenants.tenant(cfg.tenant)
+	}
+	t, err := j.tenants.tenantByIssuer(cfg.issuer)
+	if err != nil {
+		return nil, ErrUnknownTenant
+	}
+	return t, nil
+}
+
+// tenantVerificationKey retourne la clé kid du tenant dont l'émetteur est issuer.
+func (j *Tools) tenantVerificationKey(issuer, kid string) (*Key, error) {
+	t, err := j.tenants.tenantByIssuer(issuer)
+	if err != nil {
+		return nil, err
+	}
+	return t.keyRing.VerificationKey(kid, j.now())
+}
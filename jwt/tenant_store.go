@@ -0,0 +1,150 @@
+package jwt
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+	"gorm.io/gorm"
+)
+
+// tenantKeyEncryptionKeySize est la taille de la clé AES-256 qui chiffre les clés des tenants en base.
+const tenantKeyEncryptionKeySize = 32
+
+// TenantRecord est un tenant enregistré par GormTenantStore.
+type TenantRecord struct {
+	ID     string `gorm:"primaryKey"`
+	Issuer string `gorm:"uniqueIndex"`
+}
+
+// TenantKeyRecord est une clé de tenant enregistrée par GormTenantStore. La clé PEM n'est jamais
+// stockée en clair : elle est chiffrée en AES-256-GCM, et le tenant et le kid sont authentifiés
+// avec elle, si bien qu'une clé recopiée sur une autre ligne ne se déchiffre pas.
+type TenantKeyRecord struct {
+	TenantID     string `gorm:"primaryKey"`
+	KeyID        string `gorm:"primaryKey"`
+	EncryptedKey []byte // nonce suivi de la clé PEM chiffrée
+	ActivateAt   time.Time
+	RetireAt     time.Time
+}
+
+// GormTenantStore est une TenantSource persistante construite sur dbcrudops.
+type GormTenantStore struct {
+	operator *dbcrudops.Operator
+	aead     cipher.AEAD
+}
+
+// NewGormTenantStore crée un GormTenantStore et migre les tables des tenants et de leurs clés.
+// encryptionKey est la clé AES-256 (32 octets) qui chiffre les clés des tenants en base ;
+// elle se conserve hors de la base, par exemple dans AWS Secrets Manager.
+func NewGormTenantStore(operator *dbcrudops.Operator, encryptionKey []byte) (*GormTenantStore, error) {
+	if len(encryptionKey) != tenantKeyEncryptionKeySize {
+		return nil, fmt.Errorf("tenant key encryption key must be %d bytes", tenantKeyEncryptionKeySize)
+	}
+	aead, err := newGCM(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := operator.Migrate(&TenantRecord{}, &TenantKeyRecord{}); err != nil {
+		return nil, err
+	}
+	return &GormTenantStore{operator: operator, aead: aead}, nil
+}
+
+// sealKey chiffre la clé PEM d'un tenant, authentifiée avec le tenant et le kid.
+func (s *GormTenantStore) sealKey(tenantID, keyID, key string) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, []byte(key), tenantKeyAAD(tenantID, keyID)), nil
+}
+
+// openKey déchiffre la clé PEM d'un tenant chiffrée par sealKey.
+func (s *GormTenantStore) openKey(record TenantKeyRecord) (string, error) {
+	size := s.aead.NonceSize()
+	if len(record.EncryptedKey) < size {
+		return "", errors.New("key " + record.KeyID + " of tenant " + record.TenantID + ": malformed encrypted key")
+	}
+	key, err := s.aead.Open(nil, record.EncryptedKey[:size], record.EncryptedKey[size:], tenantKeyAAD(record.TenantID, record.KeyID))
+	if err != nil {
+		return "", errors.New("key " + record.KeyID + " of tenant " + record.TenantID + ": decryption failed")
+	}
+	return string(key), nil
+}
+
+// tenantKeyAAD retourne les données authentifiées avec une clé de tenant.
+func tenantKeyAAD(tenantID, keyID string) []byte {
+	return []byte(tenantID + "\x00" + keyID)
+}
+
+// Save enregistre un tenant et remplace ses clés.
+func (s *GormTenantStore) Save(tenant TenantConfig) error {
+	return s.operator.GetDb().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&TenantRecord{ID: tenant.ID, Issuer: tenant.Issuer}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tenant_id = ?", tenant.ID).Delete(&TenantKeyRecord{}).Error; err != nil {
+			return err
+		}
+		for _, key := range tenant.Keys {
+			encrypted, err := s.sealKey(tenant.ID, key.ID, key.Key)
+			if err != nil {
+				return err
+			}
+			record := &TenantKeyRecord{
+				TenantID:     tenant.ID,
+				KeyID:        key.ID,
+				EncryptedKey: encrypted,
+				ActivateAt:   key.ActivateAt,
+				RetireAt:     key.RetireAt,
+			}
+			if err := tx.Create(record).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete supprime un tenant et ses clés.
+func (s *GormTenantStore) Delete(id string) error {
+	return s.operator.GetDb().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tenant_id = ?", id).Delete(&TenantKeyRecord{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&TenantRecord{}).Error
+	})
+}
+
+func (s *GormTenantStore) Tenants() ([]TenantConfig, error) {
+	var records []TenantRecord
+	if err := s.operator.GetDb().Order("id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var keys []TenantKeyRecord
+	if err := s.operator.GetDb().Order("tenant_id, key_id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	keysByTenant := make(map[string][]TenantKeyConfig)
+	for _, key := range keys {
+		pemKey, err := s.openKey(key)
+		if err != nil {
+			return nil, err
+		}
+		keysByTenant[key.TenantID] = append(keysByTenant[key.TenantID], TenantKeyConfig{
+			ID:         key.KeyID,
+			Key:        pemKey,
+			ActivateAt: key.ActivateAt,
+			RetireAt:   key.RetireAt,
+		})
+	}
+	tenants := make([]TenantConfig, 0, len(records))
+	for _, record := range records {
+		tenants = append(tenants, TenantConfig{ID: record.ID, Issuer: record.Issuer, Keys: keysByTenant[record.ID]})
+	}
+	return tenants, nil
+}
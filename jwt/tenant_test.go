@@ -0,0 +1,199 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abdotop/tools/dbcrudops"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTenantKey génère une clé Ed25519 encodée en PEM, comme dans la configuration des tenants.
+func newTenantKey(t *testing.T) string {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func testTenants(t *testing.T) StaticTenants {
+	return StaticTenants{
+		{ID: "acme", Issuer: "https://acme.example.com", Keys: []TenantKeyConfig{{ID: "acme-1", Key: newTenantKey(t)}}},
+		{ID: "globex", Issuer: "https://globex.example.com", Keys: []TenantKeyConfig{{ID: "globex-1", Key: newTenantKey(t)}}},
+	}
+}
+
+func TestTenants(t *testing.T) {
+	registry := NewTenantRegistry()
+	assert.NoError(t, registry.Load(testTenants(t)))
+	j := New(time.Hour, WithTenants(registry), WithIssuer("https://default.example.com"))
+	j.OnError(func(error) {})
+
+	acme, err := j.GenerateToken("data", Tenant("acme"), Subject("user-1"))
+	assert.NoError(t, err)
+	globex, err := j.GenerateToken("data", Tenant("globex"), Subject("user-1"))
+	assert.NoError(t, err)
+	kid, alg := j.tokenHeader(acme)
+	assert.Equal(t, "acme-1", kid)
+	assert.Equal(t, "EdDSA", alg)
+
+	claims, err := j.ValidateToken(acme)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://acme.example.com", claims["iss"])
+	claims, err = j.ValidateToken(globex)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://globex.example.com", claims["iss"])
+
+	_, err = j.GenerateToken("data", Tenant("initech"))
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+	// Sans tenant, l'émetteur de l'instance ne désigne aucun tenant.
+	_, err = j.GenerateToken("data")
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+
+	// Un tenant retiré ne peut plus faire valider ses tokens.
+	registry.Remove("globex")
+	_, err = j.ValidateToken(globex)
+	assert.ErrorIs(t, err, ErrUnknownIssuer)
+	assert.Equal(t, 401, StatusCode(err))
+}
+
+func TestTenantsRejectForeignIssuer(t *testing.T) {
+	registry := NewTenantRegistry()
+	assert.NoError(t, registry.Load(testTenants(t)))
+	j := New(time.Hour, WithTenants(registry))
+	j.OnError(func(error) {})
+
+	// Un token signé par la clé d'acme ne peut pas se réclamer de globex.
+	keyRing, err := registry.KeyRing("acme")
+	assert.NoError(t, err)
+	forger := New(time.Hour, WithKeyRing(keyRing), WithIssuer("https://globex.example.com"))
+	forger.OnError(func(error) {})
+	forged, err := forger.GenerateToken("data")
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(forged)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+
+	// Un token d'un émetteur inconnu est refusé.
+	stranger := newTestTools(t, time.Hour)
+	WithIssuer("https://initech.example.com")(stranger)
+	token, err := stranger.GenerateToken("data")
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrUnknownIssuer)
+	var tokenErr *TokenError
+	if assert.ErrorAs(t, err, &tokenErr) {
+		assert.Equal(t, "iss", tokenErr.Claim)
+	}
+}
+
+func TestTenantsTokenPair(t *testing.T) {
+	registry := NewTenantRegistry()
+	assert.NoError(t, registry.Load(testTenants(t)))
+	j := New(time.Hour, WithTenants(registry))
+	j.OnError(func(error) {})
+
+	pair, err := j.IssueTokenPair("data", Tenant("globex"), Subject("user-1"))
+	assert.NoError(t, err)
+	pair, err = j.RefreshTokenPair(pair.RefreshToken)
+	assert.NoError(t, err)
+	claims, err := j.ValidateToken(pair.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://globex.example.com", claims["iss"])
+	kid, _ := j.tokenHeader(pair.AccessToken)
+	assert.Equal(t, "globex-1", kid)
+}
+
+func TestTenantRegistryLoadErrors(t *testing.T) {
+	registry := NewTenantRegistry()
+	assert.NoError(t, registry.Load(testTenants(t)))
+
+	duplicate := testTenants(t)
+	duplicate[1].Issuer = duplicate[0].Issuer
+	assert.Error(t, registry.Load(duplicate))
+	assert.Error(t, registry.Load(StaticTenants{{ID: "acme", Issuer: "acme", Keys: []TenantKeyConfig{{ID: "k", Key: "not a key"}}}}))
+
+	// Le registre est inchangé après un chargement en erreur.
+	_, err := registry.KeyRing("globex")
+	assert.NoError(t, err)
+}
+
+func TestFileTenantSource(t *testing.T) {
+	tenants := testTenants(t)
+	data, err := json.Marshal(tenants)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+
+	loaded, err := FileTenantSource{Path: path}.Tenants()
+	assert.NoError(t, err)
+	assert.Equal(t, []TenantConfig(tenants), loaded)
+}
+
+func TestGormTenantStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	assert.NoError(t, err)
+	operator := dbcrudops.New(db)
+	operator.OnError(func(error) {})
+	encryptionKey := make([]byte, 32)
+	_, err = rand.Read(encryptionKey)
+	assert.NoError(t, err)
+	_, err = NewGormTenantStore(operator, encryptionKey[:16])
+	assert.Error(t, err)
+	store, err := NewGormTenantStore(operator, encryptionKey)
+	assert.NoError(t, err)
+
+	tenants := testTenants(t)
+	for _, tenant := range tenants {
+		assert.NoError(t, store.Save(tenant))
+	}
+	// Enregistrer à nouveau un tenant remplace ses clés.
+	tenants[0].Keys = append(tenants[0].Keys, TenantKeyConfig{ID: "acme-2", Key: newTenantKey(t), ActivateAt: time.Now().Add(time.Hour).UTC()})
+	assert.NoError(t, store.Save(tenants[0]))
+
+	loaded, err := store.Tenants()
+	assert.NoError(t, err)
+	if assert.Len(t, loaded, 2) {
+		assert.Equal(t, "acme", loaded[0].ID)
+		assert.Len(t, loaded[0].Keys, 2)
+		assert.Equal(t, tenants[1].Keys, loaded[1].Keys)
+	}
+
+	registry := NewTenantRegistry()
+	assert.NoError(t, registry.Load(store))
+	j := New(time.Hour, WithTenants(registry))
+	j.OnError(func(error) {})
+	token, err := j.GenerateToken("data", Tenant("acme"))
+	assert.NoError(t, err)
+	kid, _ := j.tokenHeader(token)
+	assert.Equal(t, "acme-1", kid)
+	_, err = j.ValidateToken(token)
+	assert.NoError(t, err)
+
+	// Les clés sont chiffrées en base : sans la clé de chiffrement, elles ne se lisent pas.
+	var records []TenantKeyRecord
+	assert.NoError(t, db.Find(&records).Error)
+	for _, record := range records {
+		assert.NotContains(t, string(record.EncryptedKey), "PRIVATE KEY")
+	}
+	otherKey := make([]byte, 32)
+	other, err := NewGormTenantStore(operator, otherKey)
+	assert.NoError(t, err)
+	_, err = other.Tenants()
+	assert.Error(t, err)
+
+	assert.NoError(t, store.Delete("globex"))
+	loaded, err = store.Tenants()
+	assert.NoError(t, err)
+	assert.Len(t, loaded, 1)
+}
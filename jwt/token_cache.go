@@ -0,0 +1,132 @@
+package jwt
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// tokenCache est un cache LRU borné des tokens dont la signature a été vérifiée,
+// indexé par l'empreinte SHA-256 du token. Il ne remplace que la vérification
+// cryptographique : exp, nbf, iss, aud, la révocation et les sessions sont contrôlés à chaque appel.
+// Chaque entrée retient le kid et la clé qui ont vérifié le token, pour que l'appelant
+// confirme à chaque lecture que cette clé est toujours acceptée.
+type tokenCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List // du plus récemment utilisé au plus ancien
+}
+
+type tokenCacheEntry struct {
+	key       [sha256.Size]byte
+	claims    jwt.MapClaims
+	kid       string
+	verifier  interface{} // clé qui a vérifié le token
+	expiresAt time.Time
+}
+
+func newTokenCache(size int) *tokenCache {
+	return &tokenCache{
+		size:    size,
+		entries: make(map[[sha256.Size]byte]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// get retourne l'entrée du token, avec une copie profonde de ses claims, s'il est en cache et pas encore expiré.
+func (c *tokenCache) get(token string, now time.Time) (tokenCacheEntry, bool) {
+	key := sha256.Sum256([]byte(token))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return tokenCacheEntry{}, false
+	}
+	entry := *element.Value.(*tokenCacheEntry)
+	if !now.Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return tokenCacheEntry{}, false
+	}
+	c.order.MoveToFront(element)
+	entry.claims = cloneClaims(entry.claims)
+	return entry, true
+}
+
+// add met en cache jusqu'à son expiration les claims d'un token vérifié par la clé verifier, de kid donné.
+// Les tokens sans claim exp ne sont pas mis en cache.
+func (c *tokenCache) add(token string, claims jwt.MapClaims, kid string, verifier interface{}) {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return
+	}
+	key := sha256.Sum256([]byte(token))
+	entry := &tokenCacheEntry{
+		key:       key,
+		claims:    cloneClaims(claims),
+		kid:       kid,
+		verifier:  verifier,
+		expiresAt: time.Unix(int64(exp), 0),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*tokenCacheEntry).key)
+	}
+}
+
+// remove retire le token du cache.
+func (c *tokenCache) remove(token string) {
+	key := sha256.Sum256([]byte(token))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// purge vide le cache, par exemple après un changement de clé.
+func (c *tokenCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.order.Init()
+}
+
+// cloneClaims copie des claims en profondeur : les objets (data, cnf) et tableaux imbriqués
+// ne sont partagés ni entre le cache et les appelants, ni entre deux appelants.
+func cloneClaims(claims jwt.MapClaims) jwt.MapClaims {
+	return jwt.MapClaims(cloneClaimValue(map[string]interface{}(claims)).(map[string]interface{}))
+}
+
+func cloneClaimValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(v))
+		for name, item := range v {
+			clone[name] = cloneClaimValue(item)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, item := range v {
+			clone[i] = cloneClaimValue(item)
+		}
+		return clone
+	default:
+		return value
+	}
+}
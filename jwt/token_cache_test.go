@@ -0,0 +1,176 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCacheEviction(t *testing.T) {
+	cache := newTokenCache(2)
+	now := time.Now()
+	exp := float64(now.Add(time.Hour).Unix())
+	cache.add("a", jwtlib.MapClaims{"exp": exp, "sub": "a"}, "", nil)
+	cache.add("b", jwtlib.MapClaims{"exp": exp, "sub": "b"}, "", nil)
+
+	// « a » devient le plus récemment utilisé : « b » est évincé à l'ajout de « c ».
+	_, ok := cache.get("a", now)
+	assert.True(t, ok)
+	cache.add("c", jwtlib.MapClaims{"exp": exp, "sub": "c"}, "", nil)
+	_, ok = cache.get("b", now)
+	assert.False(t, ok)
+	entry, ok := cache.get("a", now)
+	assert.True(t, ok)
+	assert.Equal(t, "a", entry.claims["sub"])
+
+	// Les claims retournés sont une copie.
+	entry.claims["sub"] = "changed"
+	entry, _ = cache.get("a", now)
+	assert.Equal(t, "a", entry.claims["sub"])
+
+	_, ok = cache.get("c", now.Add(2*time.Hour))
+	assert.False(t, ok)
+
+	cache.add("no-exp", jwtlib.MapClaims{"sub": "no-exp"}, "", nil)
+	_, ok = cache.get("no-exp", now)
+	assert.False(t, ok)
+}
+
+func TestTokenCacheDeepCopy(t *testing.T) {
+	cache := newTokenCache(1)
+	now := time.Now()
+	claims := jwtlib.MapClaims{
+		"exp":  float64(now.Add(time.Hour).Unix()),
+		"data": map[string]interface{}{"plan": "pro"},
+		"aud":  []interface{}{"api"},
+	}
+	cache.add("a", claims, "", nil)
+	claims["data"].(map[string]interface{})["plan"] = "free"
+
+	// Les objets et tableaux imbriqués ne sont partagés ni avec l'appelant qui a mis en cache,
+	// ni avec ceux qui lisent le cache.
+	entry, _ := cache.get("a", now)
+	assert.Equal(t, "pro", entry.claims["data"].(map[string]interface{})["plan"])
+	entry.claims["data"].(map[string]interface{})["plan"] = "free"
+	entry.claims["aud"].([]interface{})[0] = "other"
+	entry, _ = cache.get("a", now)
+	assert.Equal(t, "pro", entry.claims["data"].(map[string]interface{})["plan"])
+	assert.Equal(t, []interface{}{"api"}, entry.claims["aud"])
+}
+
+func TestValidationCache(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	WithValidationCache(10)(j)
+	WithRevocationStore(NewMemoryRevocationStore())(j)
+	token, err := j.GenerateToken("data", Subject("user-1"))
+	assert.NoError(t, err)
+
+	claims, err := j.ValidateToken(token)
+	assert.NoError(t, err)
+	_, cached := j.tokenCache.get(token, time.Now())
+	assert.True(t, cached)
+	claims["sub"] = "changed"
+	claims, err = j.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims["sub"])
+
+	// Les attentes de l'appel s'appliquent aux claims en cache.
+	_, err = j.ValidateToken(token, ExpectAudiences("api"))
+	assert.Error(t, err)
+
+	// Un token en cache révoqué est refusé.
+	assert.NoError(t, j.RevokeToken(token))
+	_, err = j.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	// Un token en cache expiré est refusé.
+	other, err := j.GenerateToken("data")
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(other)
+	assert.NoError(t, err)
+	j.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = j.ValidateToken(other)
+	assert.Error(t, err)
+}
+
+func TestValidationCachePurgedOnKeyChange(t *testing.T) {
+	j := newTestTools(t, time.Hour)
+	WithValidationCache(10)(j)
+	token, err := j.GenerateToken("data")
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(token)
+	assert.NoError(t, err)
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	j.setKeys(newKey, &newKey.PublicKey)
+	_, err = j.ValidateToken(token)
+	assert.Error(t, err)
+}
+
+func TestValidationCacheRechecksKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	keyRing, err := NewKeyRing(Key{ID: "ring", PrivateKey: privateKey})
+	assert.NoError(t, err)
+	j := New(time.Hour, WithKeyRing(keyRing), WithValidationCache(10))
+	j.OnError(func(error) {})
+	token, err := j.GenerateToken("data")
+	assert.NoError(t, err)
+	_, err = j.ValidateToken(token)
+	assert.NoError(t, err)
+	_, cached := j.tokenCache.get(token, time.Now())
+	assert.True(t, cached)
+
+	// Un token en cache signé par une clé retirée depuis est refusé.
+	assert.NoError(t, keyRing.Retire("ring", time.Now().Add(-time.Minute)))
+	_, err = j.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+	_, cached = j.tokenCache.get(token, time.Now())
+	assert.False(t, cached)
+}
+
+// benchmarkValidateToken valide en parallèle un lot de tokens, comme une passerelle
+// qui voit passer sans cesse les mêmes tokens.
+func benchmarkValidateToken(b *testing.B, opts ...Option) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		b.Fatal(err)
+	}
+	j := New(time.Hour, opts...)
+	j.OnError(func(error) {})
+	j.privateKey = privateKey
+	j.publicKey = &privateKey.PublicKey
+
+	tokens := make([]string, 100)
+	for i := range tokens {
+		if tokens[i], err = j.GenerateToken("data", Subject("user")); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, err := j.ValidateToken(tokens[i%len(tokens)]); err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkValidateToken(b *testing.B) {
+	b.Run("uncached", func(b *testing.B) {
+		benchmarkValidateToken(b)
+	})
+	b.Run("cached", func(b *testing.B) {
+		benchmarkValidateToken(b, WithValidationCache(1000))
+	})
+}
@@ -0,0 +1,64 @@
+package jwt
+
+import (
+	"encoding/json"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TypedClaims associe des données typées aux claims enregistrés d'un token.
+// Les données sont placées dans le claim "data", comme pour GenerateToken,
+// ce qui rend les deux API interopérables.
+type TypedClaims[T any] struct {
+	Data T `json:"data"`
+	jwt.RegisteredClaims
+}
+
+// GenerateTypedToken génère un token JWT portant des données typées.
+func GenerateTypedToken[T any](j *Tools, data T, opts ...TokenOption) (string, error) {
+	return j.GenerateToken(data, opts...)
+}
+
+// ValidateTypedToken valide un token JWT et retourne ses données décodées dans T.
+func ValidateTypedToken[T any](j *Tools, tokenString string, opts ...ValidateOption) (*T, error) {
+	claims, err := ValidateTypedClaims[T](j, tokenString, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &claims.Data, nil
+}
+
+// ValidateTypedClaims valide un token JWT et retourne ses données typées avec ses claims enregistrés.
+// Si les données ne correspondent pas à T, l'erreur est une *TokenError de raison ErrTokenInvalidClaims,
+// qui enveloppe une *jwt.ValidationError de type ValidationErrorClaimsInvalid.
+func ValidateTypedClaims[T any](j *Tools, tokenString string, opts ...ValidateOption) (*TypedClaims[T], error) {
+	claims, err := j.validate(tokenString, j.newValidateConfig(opts))
+	if err == nil {
+		var typed *TypedClaims[T]
+		typed, err = decodeTypedClaims[T](claims)
+		if err == nil {
+			return typed, nil
+		}
+		err = j.tokenError(tokenString, err)
+	}
+	j.errChan <- err
+	return nil, err
+}
+
+// decodeTypedClaims convertit des claims déjà validés en TypedClaims[T] via JSON.
+func decodeTypedClaims[T any](claims jwt.MapClaims) (*TypedClaims[T], error) {
+	if _, ok := claims["data"]; !ok {
+		return nil, jwt.NewValidationError("token has no data claim", jwt.ValidationErrorClaimsInvalid)
+	}
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	var typed TypedClaims[T]
+	if err := json.Unmarshal(raw, &typed); err != nil {
+		validationErr := jwt.NewValidationError("token data does not match the expected type", jwt.ValidationErrorClaimsInvalid)
+		validationErr.Inner = err
+		return nil, validationErr
+	}
+	return &typed, nil
+}
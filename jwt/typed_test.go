@@ -0,0 +1,75 @@
+package jwt
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type testUser struct {
+	ID    string   `json:"id"`
+	Email string   `json:"email"`
+	Roles []string `json:"roles"`
+}
+
+func TestTypedTokenRoundTrip(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	user := testUser{ID: "42", Email: "user@example.com", Roles: []string{"admin"}}
+
+	// Test
+	token, err := GenerateTypedToken(j, user)
+	assert.NoError(t, err)
+	got, err := ValidateTypedToken[testUser](j, token)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, &user, got)
+
+	claims, err := ValidateTypedClaims[testUser](j, token)
+	assert.NoError(t, err)
+	assert.Equal(t, user, claims.Data)
+	assert.NotNil(t, claims.ExpiresAt)
+
+	// The MapClaims API still reads typed tokens.
+	mapClaims, err := j.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", mapClaims["data"].(map[string]interface{})["id"])
+}
+
+func TestValidateTypedTokenMismatch(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	token, err := j.GenerateToken("not a user")
+	assert.NoError(t, err)
+
+	// Test
+	_, err = ValidateTypedToken[testUser](j, token)
+
+	// Assert
+	var validationErr *jwtlib.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.NotZero(t, validationErr.Errors&jwtlib.ValidationErrorClaimsInvalid)
+	assert.ErrorIs(t, err, ErrTokenInvalidClaims)
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(err))
+}
+
+func TestValidateTypedTokenExpired(t *testing.T) {
+	// Setup
+	j := newTestTools(t, time.Hour)
+	token, err := GenerateTypedToken(j, testUser{ID: "42"}, TTL(time.Minute))
+	assert.NoError(t, err)
+	j.now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	// Test
+	_, err = ValidateTypedToken[testUser](j, token)
+
+	// Assert
+	var validationErr *jwtlib.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.NotZero(t, validationErr.Errors&jwtlib.ValidationErrorExpired)
+}